@@ -0,0 +1,147 @@
+package main
+
+/*
+$ go run ./cmd/ringsim -peers "http://localhost:8001,http://localhost:8002,http://localhost:8003=2" -add http://localhost:8004
+*/
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"geecache/consistenthash"
+	"geecache/ringstat"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+var hashes = map[string]consistenthash.Hash{
+	"crc32":  consistenthash.CRC32,
+	"fnv1a":  consistenthash.FNV1a64,
+	"xxhash": consistenthash.XXHash64,
+}
+
+// parsePeers 解析形如 "a,b=2,c" 的节点列表，"=" 后为节点权重
+func parsePeers(s string) (map[string]int, error) {
+	peers := make(map[string]int)
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		weight := 1
+		if i := strings.LastIndex(p, "="); i >= 0 {
+			w, err := strconv.Atoi(p[i+1:])
+			if err != nil {
+				return nil, fmt.Errorf("bad weight in %q: %v", p, err)
+			}
+			p, weight = p[:i], w
+		}
+		peers[p] = weight
+	}
+	return peers, nil
+}
+
+func buildRing(replicas int, fn consistenthash.Hash, peers map[string]int) *consistenthash.Map {
+	m := consistenthash.New(replicas, fn)
+	for peer, weight := range peers {
+		m.AddWeighted(peer, weight)
+	}
+	return m
+}
+
+func readKeys(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var keys []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if key := scanner.Text(); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys, scanner.Err()
+}
+
+func printReport(title string, r ringstat.Report) {
+	fmt.Println(title)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "node\tweight\tkey space\tkeys\tkey share")
+	for _, s := range r.Nodes {
+		fmt.Fprintf(w, "%s\t%d\t%.2f%%\t%d\t%.2f%%\n", s.Node, s.Weight, s.KeySpace*100, s.Keys, s.KeyShare*100)
+	}
+	w.Flush()
+	fmt.Printf("key space stddev: %.2f%%, key share stddev: %.2f%%\n\n", r.KeySpaceStdDev*100, r.KeyShareStdDev*100)
+}
+
+func main() {
+	var (
+		peerList string
+		replicas int
+		hashName string
+		numKeys  int
+		keyFile  string
+		add      string
+		remove   string
+		secret   string
+	)
+	flag.StringVar(&peerList, "peers", "", "comma separated peers, optionally with weights, e.g. a,b=2")
+	flag.IntVar(&replicas, "replicas", 50, "virtual nodes per unit of weight")
+	flag.StringVar(&hashName, "hash", "crc32", "hash function: crc32, fnv1a, xxhash or siphash")
+	flag.StringVar(&secret, "secret", "", "16 byte cluster secret for -hash siphash")
+	flag.IntVar(&numKeys, "keys", 100000, "number of synthetic keys")
+	flag.StringVar(&keyFile, "keyfile", "", "file with one key per line, overrides -keys")
+	flag.StringVar(&add, "add", "", "peers to add when simulating a rebalance")
+	flag.StringVar(&remove, "remove", "", "comma separated peers to remove when simulating a rebalance")
+	flag.Parse()
+
+	fn, ok := hashes[hashName]
+	if hashName == "siphash" {
+		if len(secret) != 16 {
+			log.Fatal("-secret must be 16 bytes for -hash siphash")
+		}
+		fn, ok = consistenthash.NewSipHash([]byte(secret)), true
+	}
+	if !ok {
+		log.Fatalf("unknown hash function %q", hashName)
+	}
+	peers, err := parsePeers(peerList)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(peers) == 0 {
+		log.Fatal("no peers given")
+	}
+
+	keys := ringstat.SyntheticKeys("key", numKeys)
+	if keyFile != "" {
+		if keys, err = readKeys(keyFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	before := buildRing(replicas, fn, peers)
+	printReport("current ring", ringstat.Analyze(before, keys))
+	if add == "" && remove == "" {
+		return
+	}
+
+	added, err := parsePeers(add)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for peer, weight := range added {
+		peers[peer] = weight
+	}
+	for _, peer := range strings.Split(remove, ",") {
+		delete(peers, strings.TrimSpace(peer))
+	}
+	after := buildRing(replicas, fn, peers)
+	printReport("new ring", ringstat.Analyze(after, keys))
+	fmt.Printf("keys moved: %.2f%%\n", ringstat.Moved(before, after, keys)*100)
+}
@@ -40,3 +40,12 @@ func (c *cache) get(key string) (value ByteView, ok bool) {
 	}
 	return
 }
+
+func (c *cache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		return
+	}
+	c.lru.RemoveKey(key)
+}
@@ -0,0 +1,185 @@
+// Package cachetest 提供淘汰策略的一致性测试，
+// lru、lfu 以及之后新增的淘汰策略都需要通过这组测试。
+package cachetest
+
+import (
+	"testing"
+)
+
+// Value 与各淘汰策略包中的 Value 接口一致
+type Value interface {
+	Len() int
+}
+
+// Policy 是一致性测试所需的缓存接口，各策略在测试中通过适配器实现它
+type Policy interface {
+	Add(key string, value Value, expiration int64)
+	Get(key string) (value Value, expiration int64, ok bool)
+	RemoveKey(key string)
+	Len() int
+	Bytes() int64
+}
+
+// Factory 按给定的字节数与记录数限制创建一个 Policy，0 表示不限制
+type Factory func(maxBytes int64, maxEntries int, onEvicted func(key string, value Value)) Policy
+
+// String 是测试使用的 Value 实现
+type String string
+
+// Len 返回字符串的长度
+func (s String) Len() int {
+	return len(s)
+}
+
+// Run 对 newPolicy 创建的缓存执行全部一致性测试
+func Run(t *testing.T, newPolicy Factory) {
+	t.Run("Get", func(t *testing.T) { testGet(t, newPolicy) })
+	t.Run("Update", func(t *testing.T) { testUpdate(t, newPolicy) })
+	t.Run("Bytes", func(t *testing.T) { testBytes(t, newPolicy) })
+	t.Run("MaxBytes", func(t *testing.T) { testMaxBytes(t, newPolicy) })
+	t.Run("MaxEntries", func(t *testing.T) { testMaxEntries(t, newPolicy) })
+	t.Run("WarmEviction", func(t *testing.T) { testWarmEviction(t, newPolicy) })
+	t.Run("Oversized", func(t *testing.T) { testOversized(t, newPolicy) })
+	t.Run("OnEvicted", func(t *testing.T) { testOnEvicted(t, newPolicy) })
+}
+
+func testGet(t *testing.T, newPolicy Factory) {
+	c := newPolicy(0, 0, nil)
+	c.Add("key1", String("1234"), 10)
+	if v, exp, ok := c.Get("key1"); !ok || v.(String) != "1234" || exp != 10 {
+		t.Fatalf("Get key1 = %v, %v, %v", v, exp, ok)
+	}
+	if _, _, ok := c.Get("key2"); ok {
+		t.Fatalf("Get key2 should miss")
+	}
+}
+
+func testUpdate(t *testing.T, newPolicy Factory) {
+	evicted := 0
+	c := newPolicy(0, 0, func(string, Value) { evicted++ })
+	c.Add("key1", String("v1"), 10)
+	c.Add("key1", String("value1"), 20)
+	if v, exp, ok := c.Get("key1"); !ok || v.(String) != "value1" || exp != 20 {
+		t.Fatalf("Get key1 after update = %v, %v, %v", v, exp, ok)
+	}
+	if c.Len() != 1 {
+		t.Fatalf("Len() = %d after update, want 1", c.Len())
+	}
+	if evicted != 0 {
+		t.Fatalf("update should not trigger OnEvicted")
+	}
+}
+
+func testBytes(t *testing.T, newPolicy Factory) {
+	c := newPolicy(0, 0, nil)
+	c.Add("k1", String("v1"), 0)
+	c.Add("k2", String("value2"), 0)
+	if b := c.Bytes(); b != 12 {
+		t.Fatalf("Bytes() = %d, want 12", b)
+	}
+	c.Add("k1", String("value1"), 0)
+	if b := c.Bytes(); b != 16 {
+		t.Fatalf("Bytes() = %d after update, want 16", b)
+	}
+	c.RemoveKey("k2")
+	c.RemoveKey("k3")
+	if b := c.Bytes(); b != 8 {
+		t.Fatalf("Bytes() = %d after remove, want 8", b)
+	}
+	c.RemoveKey("k1")
+	if c.Bytes() != 0 || c.Len() != 0 {
+		t.Fatalf("Bytes() = %d, Len() = %d on empty cache", c.Bytes(), c.Len())
+	}
+}
+
+func testMaxBytes(t *testing.T, newPolicy Factory) {
+	c := newPolicy(8, 0, nil)
+	c.Add("k1", String("v1"), 0)
+	c.Add("k2", String("v2"), 0)
+	c.Add("k3", String("v3"), 0)
+	if c.Len() != 2 || c.Bytes() > 8 {
+		t.Fatalf("Len() = %d, Bytes() = %d, want 2 entries within 8 bytes", c.Len(), c.Bytes())
+	}
+	if _, _, ok := c.Get("k3"); !ok {
+		t.Fatalf("newest entry should not be evicted")
+	}
+
+	// 更新导致超出容量时同样需要淘汰
+	c.Add("k3", String("value3"), 0)
+	if c.Bytes() > 8 {
+		t.Fatalf("Bytes() = %d after growing update, want <= 8", c.Bytes())
+	}
+}
+
+func testMaxEntries(t *testing.T, newPolicy Factory) {
+	c := newPolicy(0, 2, nil)
+	for _, k := range []string{"k1", "k2", "k3", "k4"} {
+		c.Add(k, String("v"), 0)
+		if c.Len() > 2 {
+			t.Fatalf("Len() = %d after adding %s, want <= 2", c.Len(), k)
+		}
+	}
+	if _, _, ok := c.Get("k4"); !ok {
+		t.Fatalf("newest entry should not be evicted")
+	}
+}
+
+// testWarmEviction 检查已有记录都被访问过之后，新加入的记录不会被立即淘汰
+func testWarmEviction(t *testing.T, newPolicy Factory) {
+	for _, limit := range []struct {
+		name       string
+		maxBytes   int64
+		maxEntries int
+	}{{"MaxEntries", 0, 2}, {"MaxBytes", 4, 0}} {
+		c := newPolicy(limit.maxBytes, limit.maxEntries, nil)
+		c.Add("a", String("1"), 0)
+		c.Add("b", String("2"), 0)
+		c.Get("a")
+		c.Get("b")
+		c.Add("c", String("3"), 0)
+		if _, _, ok := c.Get("c"); !ok {
+			t.Fatalf("%s: entry added to a warm cache was evicted", limit.name)
+		}
+		if c.Len() != 2 {
+			t.Fatalf("%s: Len() = %d, want 2", limit.name, c.Len())
+		}
+	}
+}
+
+func testOversized(t *testing.T, newPolicy Factory) {
+	c := newPolicy(4, 0, nil)
+	c.Add("key", String("too large"), 0)
+	if c.Len() != 0 || c.Bytes() != 0 {
+		t.Fatalf("Len() = %d, Bytes() = %d after adding oversized entry", c.Len(), c.Bytes())
+	}
+	c.Add("k", String("v"), 0)
+	if _, _, ok := c.Get("k"); !ok {
+		t.Fatalf("cache unusable after oversized entry")
+	}
+}
+
+func testOnEvicted(t *testing.T, newPolicy Factory) {
+	evicted := make(map[string]Value)
+	c := newPolicy(8, 0, func(key string, value Value) {
+		evicted[key] = value
+	})
+	c.Add("k1", String("v1"), 0)
+	c.Add("k2", String("v2"), 0)
+	c.Add("k3", String("v3"), 0)
+	if len(evicted) != 1 {
+		t.Fatalf("OnEvicted called %d times, want 1", len(evicted))
+	}
+	for k, v := range evicted {
+		if "v"+k[1:] != string(v.(String)) {
+			t.Fatalf("OnEvicted got %s = %v", k, v)
+		}
+		if _, _, ok := c.Get(k); ok {
+			t.Fatalf("evicted key %s is still cached", k)
+		}
+	}
+
+	c.RemoveKey("k3")
+	if v, ok := evicted["k3"]; !ok || v.(String) != "v3" {
+		t.Fatalf("RemoveKey should trigger OnEvicted, got %v", evicted)
+	}
+}
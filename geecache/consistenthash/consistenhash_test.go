@@ -1,14 +1,17 @@
 package consistenthash
 
 import (
+	"encoding/binary"
+	"reflect"
+	"slices"
 	"strconv"
 	"testing"
 )
 
 func TestHashing(t *testing.T) {
-	hash := New(3, func(key []byte) uint32 {
+	hash := New(3, func(key []byte) uint64 {
 		i, _ := strconv.Atoi(string(key))
-		return uint32(i)
+		return uint64(i)
 	})
 
 	// Given the above hash function, this will give replicas with "hashes":
@@ -41,3 +44,216 @@ func TestHashing(t *testing.T) {
 	}
 
 }
+
+func TestRemove(t *testing.T) {
+	hash := New(3, func(key []byte) uint64 {
+		i, _ := strconv.Atoi(string(key))
+		return uint64(i)
+	})
+
+	// 2, 4, 6, 8, 12, 14, 16, 18, 22, 24, 26, 28
+	hash.Add("6", "4", "2", "8")
+	hash.Add("8")
+	if len(hash.keys) != 12 {
+		t.Fatalf("adding an existing node should be a no-op, ring has %d points", len(hash.keys))
+	}
+
+	hash.Remove("4", "10")
+	testCases := map[string]string{
+		"2":  "2",
+		"3":  "6",
+		"23": "6",
+		"27": "8",
+		"29": "2",
+	}
+	for k, v := range testCases {
+		if hash.Get(k) != v {
+			t.Errorf("Asking for %s, should have yielded %s", k, v)
+		}
+	}
+
+	if nodes := hash.Nodes(); !reflect.DeepEqual(nodes, []string{"2", "6", "8"}) {
+		t.Errorf("Nodes() = %v", nodes)
+	}
+	if !slices.IsSorted(hash.keys) || len(hash.keys) != 9 {
+		t.Errorf("ring is inconsistent after Remove: %v", hash.keys)
+	}
+
+	hash.Remove("2", "6", "8")
+	if hash.Get("1") != "" {
+		t.Errorf("empty ring should yield no node")
+	}
+}
+
+func TestWeighted(t *testing.T) {
+	hash := New(50, nil)
+	hash.AddWeighted("small", 1)
+	hash.AddWeighted("large", 8)
+	if hash.Weight("large") != 8 || len(hash.keys) != 450 {
+		t.Fatalf("large has weight %d, ring has %d points", hash.Weight("large"), len(hash.keys))
+	}
+
+	owned := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		owned[hash.Get(strconv.Itoa(i))]++
+	}
+	if owned["large"] < 4*owned["small"] {
+		t.Errorf("weight 8 node owns %d keys, weight 1 node owns %d", owned["large"], owned["small"])
+	}
+
+	hash.Remove("large")
+	if len(hash.keys) != 50 {
+		t.Errorf("ring has %d points after removing the weighted node", len(hash.keys))
+	}
+}
+
+func TestCollision(t *testing.T) {
+	// "0a" 与 "0b" 冲突，加盐后的位置由 CRC32 决定
+	fn := func(key []byte) uint64 {
+		switch string(key) {
+		case "0a", "0b":
+			return 100
+		case "0c":
+			return 200
+		}
+		return CRC32(key)
+	}
+
+	orders := [][]string{{"a", "b", "c"}, {"c", "b", "a"}, {"b", "c", "a"}}
+	var rings []map[uint64]string
+	for _, order := range orders {
+		hash := New(1, fn)
+		for _, node := range order {
+			hash.Add(node)
+		}
+		if len(hash.keys) != 3 || len(hash.hashMap) != 3 {
+			t.Fatalf("order %v: ring has %d points, %d owners", order, len(hash.keys), len(hash.hashMap))
+		}
+		if hash.hashMap[100] != "a" {
+			t.Errorf("order %v: collided point owned by %q, want a", order, hash.hashMap[100])
+		}
+		rings = append(rings, hash.hashMap)
+	}
+	for i := 1; i < len(rings); i++ {
+		if !reflect.DeepEqual(rings[0], rings[i]) {
+			t.Errorf("order %v yields ring %v, order %v yields %v", orders[0], rings[0], orders[i], rings[i])
+		}
+	}
+
+	// 删除 a 后 b 回到原始位置
+	hash := New(1, fn)
+	hash.Add("b", "c", "a")
+	hash.Remove("a")
+	if hash.hashMap[100] != "b" || hash.salted != 0 || len(hash.keys) != 2 {
+		t.Errorf("after removing a, ring is %v", hash.hashMap)
+	}
+}
+
+func TestGetBounded(t *testing.T) {
+	hash := New(3, func(key []byte) uint64 {
+		i, _ := strconv.Atoi(string(key))
+		return uint64(i)
+	})
+	// 2, 4, 6, 12, 14, 16, 22, 24, 26
+	hash.Add("6", "4", "2")
+
+	loads := map[string]int64{}
+	load := func(node string) int64 { return loads[node] }
+	if got := hash.GetBounded("11", load, 0.25); got != "2" {
+		t.Fatalf("without load, GetBounded = %s, want 2", got)
+	}
+
+	// 容量为 ceil(1.25 * 11 / 3) = 5，节点 2 过载，溢出到环上的下一个节点 4
+	loads["2"] = 10
+	if got := hash.GetBounded("11", load, 0.25); got != "4" {
+		t.Fatalf("owner overloaded, GetBounded = %s, want 4", got)
+	}
+	// 容量为 ceil(1.25 * 20 / 3) = 9
+	loads["4"] = 9
+	if got := hash.GetBounded("11", load, 0.25); got != "6" {
+		t.Fatalf("owner and successor overloaded, GetBounded = %s, want 6", got)
+	}
+}
+
+func TestGetN(t *testing.T) {
+	hash := New(3, func(key []byte) uint64 {
+		i, _ := strconv.Atoi(string(key))
+		return uint64(i)
+	})
+	// 2, 4, 6, 12, 14, 16, 22, 24, 26
+	hash.Add("6", "4", "2")
+
+	testCases := []struct {
+		key    string
+		n      int
+		expect []string
+	}{
+		{"11", 1, []string{"2"}},
+		{"11", 2, []string{"2", "4"}},
+		{"15", 3, []string{"6", "2", "4"}},
+		{"27", 5, []string{"2", "4", "6"}},
+		{"27", 0, nil},
+	}
+	for _, tc := range testCases {
+		if got := hash.GetN(tc.key, tc.n); !reflect.DeepEqual(got, tc.expect) {
+			t.Errorf("GetN(%s, %d) = %v, want %v", tc.key, tc.n, got, tc.expect)
+		}
+	}
+
+	// 同一节点相邻的虚拟节点会被跳过
+	hash = New(2, func(key []byte) uint64 {
+		i, _ := strconv.Atoi(string(key))
+		return uint64(i)
+	})
+	// 1, 11, 20, 120
+	hash.Add("1", "20")
+	if got := hash.GetN("0", 2); !reflect.DeepEqual(got, []string{"1", "20"}) {
+		t.Errorf("GetN(0, 2) = %v, want [1 20]", got)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	hash := New(10, XXHash64)
+	hash.Add("a", "b")
+	hash.AddWeighted("c", 3)
+
+	other := New(10, XXHash64)
+	other.AddWeighted("c", 3)
+	other.Add("b", "a")
+	if hash.Fingerprint() != other.Fingerprint() {
+		t.Fatalf("fingerprint depends on the order nodes were added")
+	}
+	other.Remove("a")
+	if hash.Fingerprint() == other.Fingerprint() {
+		t.Fatalf("fingerprint does not reflect membership")
+	}
+
+	restored, err := Restore(hash.Snapshot(), XXHash64)
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if restored.Fingerprint() != hash.Fingerprint() || restored.Weight("c") != 3 {
+		t.Fatalf("restored ring differs from the original")
+	}
+	if _, err := Restore(hash.Snapshot(), CRC32); err == nil {
+		t.Fatalf("Restore with a different hash function should fail")
+	}
+	if _, err := Restore(hash.Snapshot()[:5], XXHash64); err == nil {
+		t.Fatalf("Restore of a truncated snapshot should fail")
+	}
+
+	// 虚拟节点数过大的快照在建环之前就被拒绝
+	hostile := func(replicas, weight uint64) []byte {
+		buf := binary.AppendUvarint([]byte{snapshotVersion}, replicas)
+		buf = binary.AppendUvarint(buf, 1)
+		buf = binary.AppendUvarint(buf, 1)
+		buf = append(buf, 'a')
+		buf = binary.AppendUvarint(buf, weight)
+		return binary.BigEndian.AppendUint64(buf, 0)
+	}
+	for _, rw := range [][2]uint64{{1 << 62, 1}, {1, 1 << 62}, {1 << 12, 1 << 12}} {
+		if _, err := Restore(hostile(rw[0], rw[1]), XXHash64); err != errBadSnapshot {
+			t.Fatalf("Restore with %d replicas of weight %d = %v, want errBadSnapshot", rw[0], rw[1], err)
+		}
+	}
+}
@@ -1,45 +1,225 @@
 package consistenthash
 
 import (
-	"hash/crc32"
+	"math"
+	"slices"
 	"sort"
 	"strconv"
 )
 
-// Hash 将字节映射到 uint32
-type Hash func(data []byte) uint32
+// maxSalt 是虚拟节点发生哈希冲突时最多尝试加盐的次数
+const maxSalt = 16
+
+// Hash 将字节映射到 uint64，内置的实现见 hash.go
+type Hash func(data []byte) uint64
 
 // Map 包含所有已哈希映射的键
 type Map struct {
-	hash     Hash  //哈希函数
-	replicas int   // 虚拟节点倍数
-	keys     []int // 哈希环
-	hashMap  map[int]string
+	hash     Hash     //哈希函数
+	replicas int      // 虚拟节点倍数
+	keys     []uint64 // 哈希环
+	hashMap  map[uint64]string
+	nodes    map[string]int // 真实节点及其权重
+	salted   int            // 因哈希冲突而加盐放置的虚拟节点数
 }
 
-// New 创建一个 Map 实例
+// New 创建一个 Map 实例，fn 为 nil 时使用 CRC32
 func New(replicas int, fn Hash) *Map {
 	m := &Map{
 		replicas: replicas,
 		hash:     fn,
-		hashMap:  make(map[int]string),
+		hashMap:  make(map[uint64]string),
+		nodes:    make(map[string]int),
 	}
 	if m.hash == nil {
-		m.hash = crc32.ChecksumIEEE
+		m.hash = CRC32
 	}
 	return m
 }
 
-// Add 向哈希中添加一些真实节点。
+// virtualHash 计算节点 key 的第 i 个虚拟节点加 salt 次盐后的哈希值，
+// salt 为 0 时即为虚拟节点的原始位置。
+func (m *Map) virtualHash(key string, i, salt int) uint64 {
+	data := strconv.Itoa(i) + key
+	if salt > 0 {
+		data += "#" + strconv.Itoa(salt)
+	}
+	return m.hash([]byte(data))
+}
+
+// Add 向哈希中添加一些权重为 1 的真实节点，已存在的节点会被忽略。
+// 只对新增的虚拟节点排序，再与原有的哈希环归并，不会重新排序整个哈希环。
 func (m *Map) Add(keys ...string) {
+	var added []uint64
+	collided := false
 	for _, key := range keys {
-		for i := 0; i < m.replicas; i++ {
-			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
-			m.keys = append(m.keys, hash)
-			m.hashMap[hash] = key
+		var c bool
+		added, c = m.add(added, key, 1)
+		collided = collided || c
+	}
+	m.insert(added, collided)
+}
+
+// AddWeighted 向哈希中添加一个真实节点，其虚拟节点数为 replicas * weight，
+// weight 小于 1 时按 1 处理。已存在的节点会被忽略，修改权重需要先 Remove。
+func (m *Map) AddWeighted(key string, weight int) {
+	m.insert(m.add(nil, key, weight))
+}
+
+// AddAllWeighted 向哈希中添加一些带权重的真实节点，哈希环只归并一次
+func (m *Map) AddAllWeighted(weights map[string]int) {
+	var added []uint64
+	collided := false
+	for key, weight := range weights {
+		var c bool
+		added, c = m.add(added, key, weight)
+		collided = collided || c
+	}
+	m.insert(added, collided)
+}
+
+// add 登记节点并把它的虚拟节点追加到 added 中，
+// 如果某个虚拟节点与已有的虚拟节点冲突则返回 collided 为 true。
+func (m *Map) add(added []uint64, key string, weight int) (_ []uint64, collided bool) {
+	if _, ok := m.nodes[key]; ok {
+		return added, false
+	}
+	if weight < 1 {
+		weight = 1
+	}
+	m.nodes[key] = weight
+	for i := 0; i < m.replicas*weight; i++ {
+		hash := m.virtualHash(key, i, 0)
+		if _, ok := m.hashMap[hash]; ok {
+			collided = true
+			continue
 		}
+		added = append(added, hash)
+		m.hashMap[hash] = key
+	}
+	return added, collided
+}
+
+// insert 将新增的虚拟节点排序后归并到哈希环中。
+// 发生冲突时，冲突的归属取决于节点加入的顺序，此时需要重建整个哈希环。
+func (m *Map) insert(added []uint64, collided bool) {
+	if collided {
+		m.rebuild()
+		return
+	}
+	if len(added) == 0 {
+		return
+	}
+	slices.Sort(added)
+	m.keys = merge(m.keys, added)
+}
+
+// rebuild 按节点名的字典序重新放置所有虚拟节点。
+// 虚拟节点优先使用原始位置，被占用时依次加盐直到找到空位，
+// 因此无论节点以何种顺序加入，每个节点上得到的哈希环都完全相同。
+// 加盐 maxSalt 次仍然冲突的虚拟节点会被丢弃。
+func (m *Map) rebuild() {
+	m.keys = m.keys[:0]
+	m.hashMap = make(map[uint64]string, len(m.hashMap))
+	m.salted = 0
+	for _, key := range m.Nodes() {
+		for i := 0; i < m.replicas*m.nodes[key]; i++ {
+			for salt := 0; salt <= maxSalt; salt++ {
+				hash := m.virtualHash(key, i, salt)
+				if _, ok := m.hashMap[hash]; ok {
+					continue
+				}
+				if salt > 0 {
+					m.salted++
+				}
+				m.keys = append(m.keys, hash)
+				m.hashMap[hash] = key
+				break
+			}
+		}
+	}
+	slices.Sort(m.keys)
+}
+
+// merge 归并两个有序的切片
+func merge(a, b []uint64) []uint64 {
+	merged := make([]uint64, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if a[i] <= b[j] {
+			merged = append(merged, a[i])
+			i++
+		} else {
+			merged = append(merged, b[j])
+			j++
+		}
+	}
+	merged = append(merged, a[i:]...)
+	return append(merged, b[j:]...)
+}
+
+// Remove 从哈希中删除一些真实节点及其虚拟节点，其余节点的位置不受影响。
+func (m *Map) Remove(keys ...string) {
+	if m.salted > 0 {
+		// 删除节点后，加盐的虚拟节点可能可以回到原始位置，需要重建哈希环
+		n := len(m.nodes)
+		for _, key := range keys {
+			delete(m.nodes, key)
+		}
+		if len(m.nodes) != n {
+			m.rebuild()
+		}
+		return
+	}
+	removed := make(map[uint64]struct{})
+	for _, key := range keys {
+		weight, ok := m.nodes[key]
+		if !ok {
+			continue
+		}
+		delete(m.nodes, key)
+		for i := 0; i < m.replicas*weight; i++ {
+			hash := m.virtualHash(key, i, 0)
+			if m.hashMap[hash] == key {
+				delete(m.hashMap, hash)
+				removed[hash] = struct{}{}
+			}
+		}
+	}
+	if len(removed) == 0 {
+		return
+	}
+	ring := m.keys[:0]
+	for _, hash := range m.keys {
+		if _, ok := removed[hash]; !ok {
+			ring = append(ring, hash)
+		}
+	}
+	m.keys = ring
+}
+
+// Weight 返回节点的权重，节点不存在时返回 0。
+func (m *Map) Weight(key string) int {
+	return m.nodes[key]
+}
+
+// Nodes 按字典序返回所有真实节点。
+func (m *Map) Nodes() []string {
+	nodes := make([]string, 0, len(m.nodes))
+	for node := range m.nodes {
+		nodes = append(nodes, node)
 	}
-	sort.Ints(m.keys)
+	sort.Strings(nodes)
+	return nodes
+}
+
+// search 二分查找键在哈希环上顺时针方向的第一个虚拟节点的下标，
+// 返回值可能等于 len(m.keys)，使用时需要对环长取模。
+func (m *Map) search(key string) int {
+	hash := m.hash([]byte(key))
+	return sort.Search(len(m.keys), func(i int) bool {
+		return m.keys[i] >= hash
+	})
 }
 
 // Get 获取哈希中最接近提供的键的项。
@@ -48,11 +228,91 @@ func (m *Map) Get(key string) string {
 		return ""
 	}
 
-	hash := int(m.hash([]byte(key)))
-	// 二分查找适当的副本。
-	idx := sort.Search(len(m.keys), func(i int) bool {
-		return m.keys[i] >= hash
-	})
+	idx := m.search(key)
 
 	return m.hashMap[m.keys[idx%len(m.keys)]]
 }
+
+// GetN 从键在哈希环上的位置开始顺时针查找，返回最多 n 个不同的真实节点，
+// 属于已选节点的虚拟节点会被跳过。第一个节点与 Get 的结果相同。
+func (m *Map) GetN(key string, n int) []string {
+	if len(m.keys) == 0 || n <= 0 {
+		return nil
+	}
+	if n > len(m.nodes) {
+		n = len(m.nodes)
+	}
+
+	idx := m.search(key)
+
+	nodes := make([]string, 0, n)
+	seen := make(map[string]struct{}, n)
+	for i := 0; i < len(m.keys) && len(nodes) < n; i++ {
+		node := m.hashMap[m.keys[(idx+i)%len(m.keys)]]
+		if _, ok := seen[node]; ok {
+			continue
+		}
+		seen[node] = struct{}{}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+var _ BatchWeightedPlacement = (*Map)(nil)
+
+// GetBounded 实现了有界负载的一致性哈希（Consistent Hashing with Bounded Loads）。
+// load 返回节点当前的负载，每个节点的容量为 ceil((1+epsilon) * (总负载+1) / 节点数)，
+// 从键的位置开始顺时针查找，返回第一个负载低于容量的节点。
+// 负载均衡时结果与 Get 相同；热点键使负责的节点过载时，请求会溢出到环上的下一个节点。
+func (m *Map) GetBounded(key string, load func(node string) int64, epsilon float64) string {
+	if len(m.keys) == 0 {
+		return ""
+	}
+
+	var total int64
+	for node := range m.nodes {
+		total += load(node)
+	}
+	capacity := int64(math.Ceil((1 + epsilon) * float64(total+1) / float64(len(m.nodes))))
+
+	idx := m.search(key)
+
+	checked := make(map[string]struct{})
+	for i := 0; i < len(m.keys) && len(checked) < len(m.nodes); i++ {
+		node := m.hashMap[m.keys[(idx+i)%len(m.keys)]]
+		if _, ok := checked[node]; ok {
+			continue
+		}
+		if load(node) < capacity {
+			return node
+		}
+		checked[node] = struct{}{}
+	}
+	// 总负载小于所有节点容量之和，正常情况下不会到达这里
+	return m.hashMap[m.keys[idx%len(m.keys)]]
+}
+
+var (
+	_ BoundedPlacement = (*Map)(nil)
+	_ Fingerprinter    = (*Map)(nil)
+)
+
+// Shares 返回每个真实节点在哈希空间中所占的比例，所有比例之和为 1。
+// 每个虚拟节点负责从上一个虚拟节点（不含）到它自己（含）的一段哈希空间。
+func (m *Map) Shares() map[string]float64 {
+	shares := make(map[string]float64, len(m.nodes))
+	if len(m.keys) == 1 {
+		shares[m.hashMap[m.keys[0]]] = 1
+	}
+	if len(m.keys) < 2 {
+		return shares
+	}
+	const space = float64(1<<63) * 2
+	// 第一个虚拟节点负责从最后一个虚拟节点绕回来的部分，无符号减法会自然回绕
+	prev := m.keys[len(m.keys)-1]
+	for _, hash := range m.keys {
+		shares[m.hashMap[hash]] += float64(hash-prev) / space
+		prev = hash
+	}
+	return shares
+}
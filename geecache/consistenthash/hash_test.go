@@ -0,0 +1,44 @@
+package consistenthash
+
+import (
+	"testing"
+)
+
+func TestXXHash64(t *testing.T) {
+	testCases := map[string]uint64{
+		"":    0xef46db3751d8e999,
+		"a":   0xd24ec4f1a98c6e5b,
+		"abc": 0x44bc2cf5ad770999,
+		"Nobody inspects the spammish repetition": 0xfbcea83c8a378bf1,
+	}
+	for data, expect := range testCases {
+		if h := XXHash64([]byte(data)); h != expect {
+			t.Errorf("XXHash64(%q) = %#x, want %#x", data, h, expect)
+		}
+	}
+}
+
+func TestSipHash(t *testing.T) {
+	// 参考实现中的测试向量：密钥为 00..0f，消息为 00..(n-1)
+	key := make([]byte, 16)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	msg := make([]byte, 15)
+	for i := range msg {
+		msg[i] = byte(i)
+	}
+	h := NewSipHash(key)
+	if got := h(nil); got != 0x726fdb47dd0e0e31 {
+		t.Errorf("SipHash(empty) = %#x", got)
+	}
+	if got := h(msg); got != 0xa129ca6149be45e5 {
+		t.Errorf("SipHash(00..0e) = %#x", got)
+	}
+}
+
+func TestFNV1a64(t *testing.T) {
+	if h := FNV1a64([]byte("a")); h != mix64(0xaf63dc4c8601ec8c) {
+		t.Errorf("FNV1a64(a) = %#x", h)
+	}
+}
@@ -0,0 +1,89 @@
+package consistenthash
+
+import (
+	"sort"
+)
+
+// Jump 实现了 Jump 一致性哈希（Lamping & Veach, 2014）。
+// 它不需要任何额外的存储，各桶分到的键几乎完全均匀，
+// 但只有在末尾追加或删除桶时才能保证迁移最少的键。
+// 为了让各节点得到相同的结果，节点按名字排序后编号，
+// 因此在中间插入或删除节点会导致较多的键迁移。不支持权重。
+type Jump struct {
+	hash  Hash
+	nodes []string // 按名字排序
+}
+
+// NewJump 创建一个 Jump 实例，fn 为 nil 时使用 CRC32
+func NewJump(fn Hash) *Jump {
+	j := &Jump{hash: fn}
+	if j.hash == nil {
+		j.hash = CRC32
+	}
+	return j
+}
+
+// Add 添加一些节点
+func (j *Jump) Add(nodes ...string) {
+	for _, node := range nodes {
+		i := sort.SearchStrings(j.nodes, node)
+		if i < len(j.nodes) && j.nodes[i] == node {
+			continue
+		}
+		j.nodes = append(j.nodes, "")
+		copy(j.nodes[i+1:], j.nodes[i:])
+		j.nodes[i] = node
+	}
+}
+
+// Remove 删除一些节点
+func (j *Jump) Remove(nodes ...string) {
+	for _, node := range nodes {
+		i := sort.SearchStrings(j.nodes, node)
+		if i < len(j.nodes) && j.nodes[i] == node {
+			j.nodes = append(j.nodes[:i], j.nodes[i+1:]...)
+		}
+	}
+}
+
+// jumpHash 将 key 映射到 [0, buckets) 中的一个桶
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+// Get 返回负责 key 的节点
+func (j *Jump) Get(key string) string {
+	if len(j.nodes) == 0 {
+		return ""
+	}
+	return j.nodes[jumpHash(mix64(j.hash([]byte(key))), len(j.nodes))]
+}
+
+// GetN 返回最多 n 个节点：第一个与 Get 相同，
+// 之后每次在剩余的节点中用重新打散的哈希值继续选择。
+func (j *Jump) GetN(key string, n int) []string {
+	if n <= 0 || len(j.nodes) == 0 {
+		return nil
+	}
+	if n > len(j.nodes) {
+		n = len(j.nodes)
+	}
+	rest := append([]string(nil), j.nodes...)
+	h := mix64(j.hash([]byte(key)))
+	nodes := make([]string, 0, n)
+	for len(nodes) < n {
+		i := jumpHash(h, len(rest))
+		nodes = append(nodes, rest[i])
+		rest = append(rest[:i], rest[i+1:]...)
+		h = mix64(h)
+	}
+	return nodes
+}
+
+var _ Placement = (*Jump)(nil)
@@ -0,0 +1,181 @@
+package consistenthash
+
+import (
+	"sort"
+)
+
+// DefaultMaglevTableSize 是 Maglev 查找表的默认大小，需要是远大于节点数的质数
+const DefaultMaglevTableSize = 65537
+
+// Maglev 实现了 Google Maglev 负载均衡器中的一致性哈希。
+// 每个节点按自己的排列轮流填充一张固定大小的查找表，
+// 各节点分到的槽位数几乎完全相同（按权重成比例），Get 只需一次查表。
+// 增删节点后需要重新填充查找表，只有少量槽位会改变归属。
+type Maglev struct {
+	hash  Hash
+	size  uint64
+	nodes map[string]int // 节点及其权重
+	table []string
+}
+
+// NewMaglev 创建一个 Maglev 实例。size 为查找表大小，不是质数时向上取到最近的质数，
+// 为 0 时使用 DefaultMaglevTableSize；fn 为 nil 时使用 CRC32。
+func NewMaglev(size int, fn Hash) *Maglev {
+	if size <= 0 {
+		size = DefaultMaglevTableSize
+	}
+	for !isPrime(size) {
+		size++
+	}
+	m := &Maglev{
+		hash:  fn,
+		size:  uint64(size),
+		nodes: make(map[string]int),
+	}
+	if m.hash == nil {
+		m.hash = CRC32
+	}
+	return m
+}
+
+// isPrime 判断 n 是否为质数。查找表大小为质数时，任意步长都能遍历所有槽位。
+func isPrime(n int) bool {
+	if n < 2 {
+		return false
+	}
+	for i := 2; i*i <= n; i++ {
+		if n%i == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Add 添加一些权重为 1 的节点
+func (m *Maglev) Add(nodes ...string) {
+	changed := false
+	for _, node := range nodes {
+		if _, ok := m.nodes[node]; !ok {
+			m.nodes[node] = 1
+			changed = true
+		}
+	}
+	if changed {
+		m.populate()
+	}
+}
+
+// AddWeighted 添加一个节点，它每轮填充 weight 个槽位，weight 小于 1 时按 1 处理
+func (m *Maglev) AddWeighted(node string, weight int) {
+	m.AddAllWeighted(map[string]int{node: weight})
+}
+
+// AddAllWeighted 添加一些带权重的节点，查找表只重新填充一次
+func (m *Maglev) AddAllWeighted(weights map[string]int) {
+	changed := false
+	for node, weight := range weights {
+		if _, ok := m.nodes[node]; ok {
+			continue
+		}
+		if weight < 1 {
+			weight = 1
+		}
+		m.nodes[node] = weight
+		changed = true
+	}
+	if changed {
+		m.populate()
+	}
+}
+
+// Remove 删除一些节点
+func (m *Maglev) Remove(nodes ...string) {
+	changed := false
+	for _, node := range nodes {
+		if _, ok := m.nodes[node]; ok {
+			delete(m.nodes, node)
+			changed = true
+		}
+	}
+	if changed {
+		m.populate()
+	}
+}
+
+// populate 按 Maglev 论文中的算法重新填充查找表。
+// 节点按名字排序后轮流填充，保证各节点得到相同的查找表。
+func (m *Maglev) populate() {
+	if len(m.nodes) == 0 {
+		m.table = nil
+		return
+	}
+	names := make([]string, 0, len(m.nodes))
+	for node := range m.nodes {
+		names = append(names, node)
+	}
+	sort.Strings(names)
+
+	offsets := make([]uint64, len(names))
+	skips := make([]uint64, len(names))
+	next := make([]uint64, len(names))
+	for i, name := range names {
+		h := mix64(m.hash([]byte(name)))
+		offsets[i] = h % m.size
+		skips[i] = mix64(h)%(m.size-1) + 1
+	}
+
+	table := make([]string, m.size)
+	filled := make([]bool, m.size)
+	var n uint64
+	for {
+		for i, name := range names {
+			for w := 0; w < m.nodes[name]; w++ {
+				c := (offsets[i] + next[i]*skips[i]) % m.size
+				for filled[c] {
+					next[i]++
+					c = (offsets[i] + next[i]*skips[i]) % m.size
+				}
+				table[c] = name
+				filled[c] = true
+				next[i]++
+				n++
+				if n == m.size {
+					m.table = table
+					return
+				}
+			}
+		}
+	}
+}
+
+// Get 返回负责 key 的节点
+func (m *Maglev) Get(key string) string {
+	if len(m.table) == 0 {
+		return ""
+	}
+	return m.table[mix64(m.hash([]byte(key)))%m.size]
+}
+
+// GetN 从键对应的槽位开始向后查找，返回最多 n 个不同的节点
+func (m *Maglev) GetN(key string, n int) []string {
+	if n <= 0 || len(m.table) == 0 {
+		return nil
+	}
+	if n > len(m.nodes) {
+		n = len(m.nodes)
+	}
+	slot := mix64(m.hash([]byte(key))) % m.size
+	nodes := make([]string, 0, n)
+	seen := make(map[string]struct{}, n)
+	for i := uint64(0); i < m.size && len(nodes) < n; i++ {
+		node := m.table[(slot+i)%m.size]
+		if _, ok := seen[node]; ok {
+			continue
+		}
+		seen[node] = struct{}{}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+var _ BatchWeightedPlacement = (*Maglev)(nil)
@@ -0,0 +1,54 @@
+package consistenthash
+
+// Placement 是节点放置策略，决定每个键由哪个节点负责。
+// 哈希环 Map 之外，还提供了 Rendezvous、Jump 与 Maglev 三种实现。
+// 实现不保证并发安全，由调用方加锁。
+type Placement interface {
+	// Add 添加一些节点，已存在的节点会被忽略
+	Add(nodes ...string)
+	// Remove 删除一些节点
+	Remove(nodes ...string)
+	// Get 返回负责 key 的节点，没有节点时返回空字符串
+	Get(key string) string
+	// GetN 按优先级返回最多 n 个负责 key 的不同节点，第一个与 Get 的结果相同
+	GetN(key string, n int) []string
+}
+
+// WeightedPlacement 是支持节点权重的 Placement，
+// 节点分到的键的比例与其权重成正比。
+type WeightedPlacement interface {
+	Placement
+	AddWeighted(node string, weight int)
+}
+
+// BatchWeightedPlacement 是可以一次添加多个带权重节点的 WeightedPlacement。
+// 对每次添加都要重建内部结构的实现（如 Maglev），批量添加只需重建一次。
+type BatchWeightedPlacement interface {
+	WeightedPlacement
+	// AddAllWeighted 添加 weights 中的节点，已存在的节点会被忽略
+	AddAllWeighted(weights map[string]int)
+}
+
+// BoundedPlacement 是支持有界负载的 Placement，
+// 负责键的节点过载时，键会被分配给按优先级排在后面的节点。
+type BoundedPlacement interface {
+	Placement
+	GetBounded(key string, load func(node string) int64, epsilon float64) string
+}
+
+// mix64 是 splitmix64 的终结函数，用于把较弱的哈希值（如 CRC32）打散到 64 位。
+// CRC 是线性的，相同长度的数据的 CRC 异或值与内容无关，不能直接用来比较不同节点。
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Fingerprinter 是可以计算指纹的 Placement，
+// 各节点比较指纹即可发现彼此对键的归属是否存在分歧。
+type Fingerprinter interface {
+	Fingerprint() uint64
+}
@@ -0,0 +1,135 @@
+package consistenthash
+
+import (
+	"strconv"
+	"testing"
+)
+
+func placements() map[string]func() Placement {
+	return map[string]func() Placement{
+		"ring":       func() Placement { return New(50, nil) },
+		"rendezvous": func() Placement { return NewRendezvous(nil) },
+		"jump":       func() Placement { return NewJump(nil) },
+		"maglev":     func() Placement { return NewMaglev(1009, nil) },
+	}
+}
+
+func TestPlacement(t *testing.T) {
+	nodes := []string{"a", "b", "c", "d"}
+	for name, newPlacement := range placements() {
+		t.Run(name, func(t *testing.T) {
+			p := newPlacement()
+			if p.Get("key") != "" || p.GetN("key", 2) != nil {
+				t.Fatalf("empty placement should yield no node")
+			}
+
+			p.Add(nodes...)
+			q := newPlacement()
+			q.Add("d", "c", "b", "a")
+			owned := make(map[string]int)
+			for i := 0; i < 1000; i++ {
+				key := strconv.Itoa(i)
+				owner := p.Get(key)
+				if owner != q.Get(key) {
+					t.Fatalf("owner of %s depends on the order nodes were added", key)
+				}
+				owned[owner]++
+
+				all := p.GetN(key, 10)
+				if len(all) != len(nodes) || all[0] != owner {
+					t.Fatalf("GetN(%s) = %v, owner %s", key, all, owner)
+				}
+				seen := make(map[string]bool)
+				for _, n := range all {
+					if seen[n] {
+						t.Fatalf("GetN(%s) = %v contains duplicates", key, all)
+					}
+					seen[n] = true
+				}
+			}
+			if len(owned) != len(nodes) {
+				t.Fatalf("keys are spread over %v", owned)
+			}
+
+			p.Remove("b")
+			for i := 0; i < 1000; i++ {
+				if p.Get(strconv.Itoa(i)) == "b" {
+					t.Fatalf("removed node still owns keys")
+				}
+			}
+		})
+	}
+}
+
+func TestPlacementMinimalDisruption(t *testing.T) {
+	// Jump 只有删除最后一个节点时迁移最少，这里删除按名字排序的最后一个节点
+	for name, newPlacement := range placements() {
+		t.Run(name, func(t *testing.T) {
+			p := newPlacement()
+			p.Add("a", "b", "c", "d", "e")
+			before := make(map[string]string)
+			for i := 0; i < 1000; i++ {
+				key := strconv.Itoa(i)
+				before[key] = p.Get(key)
+			}
+			p.Remove("e")
+			moved := 0
+			for key, owner := range before {
+				if owner != "e" && p.Get(key) != owner {
+					moved++
+				}
+			}
+			// Maglev 允许少量槽位改变归属
+			if moved > 20 {
+				t.Errorf("%d keys not owned by the removed node moved", moved)
+			}
+		})
+	}
+}
+
+func TestWeightedPlacement(t *testing.T) {
+	weighted := map[string]WeightedPlacement{
+		"rendezvous": NewRendezvous(nil),
+		"maglev":     NewMaglev(0, nil),
+	}
+	for name, p := range weighted {
+		t.Run(name, func(t *testing.T) {
+			p.AddWeighted("small", 1)
+			p.AddWeighted("large", 4)
+			owned := make(map[string]int)
+			for i := 0; i < 10000; i++ {
+				owned[p.Get(strconv.Itoa(i))]++
+			}
+			if ratio := float64(owned["large"]) / float64(owned["small"]); ratio < 3 || ratio > 5 {
+				t.Errorf("weight 4 node owns %d keys, weight 1 node owns %d", owned["large"], owned["small"])
+			}
+		})
+	}
+}
+
+func TestBatchWeightedPlacement(t *testing.T) {
+	weights := make(map[string]int)
+	for i := 0; i < 20; i++ {
+		weights["node"+strconv.Itoa(i)] = i%3 + 1
+	}
+	batched := map[string][2]BatchWeightedPlacement{
+		"map":    {New(50, nil), New(50, nil)},
+		"maglev": {NewMaglev(0, nil), NewMaglev(0, nil)},
+	}
+	for name, p := range batched {
+		t.Run(name, func(t *testing.T) {
+			batch, single := p[0], p[1]
+			batch.AddAllWeighted(weights)
+			for node, weight := range weights {
+				single.AddWeighted(node, weight)
+			}
+			// 批量添加与逐个添加的结果相同
+			for i := 0; i < 1000; i++ {
+				key := strconv.Itoa(i)
+				if batch.Get(key) != single.Get(key) {
+					t.Fatalf("Get(%s) = %s after a batch, %s after single adds", key, batch.Get(key), single.Get(key))
+				}
+			}
+		})
+	}
+}
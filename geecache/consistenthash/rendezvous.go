@@ -0,0 +1,120 @@
+package consistenthash
+
+import (
+	"math"
+	"sort"
+)
+
+// Rendezvous 实现了最高随机权重（HRW）哈希：
+// 对每个键，计算它与每个节点组合后的得分，得分最高的节点负责该键。
+// 增删节点时只有归属于该节点的键会迁移，且无需虚拟节点，内存占用与节点数成正比。
+// Get 的时间复杂度为 O(节点数)，适合节点数不多的集群。
+type Rendezvous struct {
+	hash  Hash
+	nodes map[string]*rendezvousNode
+}
+
+type rendezvousNode struct {
+	name   string
+	hash   uint64
+	weight float64
+}
+
+// NewRendezvous 创建一个 Rendezvous 实例，fn 为 nil 时使用 CRC32
+func NewRendezvous(fn Hash) *Rendezvous {
+	r := &Rendezvous{
+		hash:  fn,
+		nodes: make(map[string]*rendezvousNode),
+	}
+	if r.hash == nil {
+		r.hash = CRC32
+	}
+	return r
+}
+
+// Add 添加一些权重为 1 的节点
+func (r *Rendezvous) Add(nodes ...string) {
+	for _, node := range nodes {
+		r.AddWeighted(node, 1)
+	}
+}
+
+// AddWeighted 添加一个节点，weight 小于 1 时按 1 处理
+func (r *Rendezvous) AddWeighted(node string, weight int) {
+	if _, ok := r.nodes[node]; ok {
+		return
+	}
+	if weight < 1 {
+		weight = 1
+	}
+	r.nodes[node] = &rendezvousNode{
+		name:   node,
+		hash:   mix64(r.hash([]byte(node))),
+		weight: float64(weight),
+	}
+}
+
+// Remove 删除一些节点
+func (r *Rendezvous) Remove(nodes ...string) {
+	for _, node := range nodes {
+		delete(r.nodes, node)
+	}
+}
+
+// score 计算节点对某个键的得分。
+// 使用 -weight / ln(u) 的加权形式，u 为 (0, 1) 内均匀分布的随机数，
+// 使节点被选中的概率与权重成正比。
+func (n *rendezvousNode) score(keyHash uint64) float64 {
+	h := mix64(keyHash ^ n.hash)
+	u := (float64(h>>11) + 0.5) / (1 << 53)
+	return -n.weight / math.Log(u)
+}
+
+// Get 返回得分最高的节点
+func (r *Rendezvous) Get(key string) string {
+	keyHash := mix64(r.hash([]byte(key)))
+	var best *rendezvousNode
+	bestScore := 0.0
+	for _, n := range r.nodes {
+		s := n.score(keyHash)
+		if best == nil || s > bestScore || (s == bestScore && n.name < best.name) {
+			best, bestScore = n, s
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return best.name
+}
+
+// GetN 按得分从高到低返回最多 n 个节点
+func (r *Rendezvous) GetN(key string, n int) []string {
+	if n <= 0 || len(r.nodes) == 0 {
+		return nil
+	}
+	keyHash := mix64(r.hash([]byte(key)))
+	type scored struct {
+		name  string
+		score float64
+	}
+	all := make([]scored, 0, len(r.nodes))
+	for _, node := range r.nodes {
+		all = append(all, scored{node.name, node.score(keyHash)})
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].score != all[j].score {
+			return all[i].score > all[j].score
+		}
+		return all[i].name < all[j].name
+	})
+	if n > len(all) {
+		n = len(all)
+	}
+	nodes := make([]string, n)
+	for i := range nodes {
+		nodes[i] = all[i].name
+	}
+	return nodes
+}
+
+var _ WeightedPlacement = (*Rendezvous)(nil)
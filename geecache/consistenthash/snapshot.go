@@ -0,0 +1,105 @@
+package consistenthash
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+)
+
+const (
+	// snapshotVersion 是快照格式的版本号
+	snapshotVersion = 1
+	// maxSnapshotVirtualNodes 是 Restore 接受的虚拟节点总数上限，
+	// 避免损坏或恶意的快照耗尽 CPU 与内存
+	maxSnapshotVirtualNodes = 1 << 22
+)
+
+// Fingerprint 返回哈希环的指纹。指纹由环上每个虚拟节点的位置与归属计算得到，
+// 只有成员、权重、虚拟节点倍数与哈希函数都相同的两个哈希环指纹才会相同，
+// 与节点加入的顺序无关。时间复杂度与虚拟节点数成正比，调用方应缓存结果。
+func (m *Map) Fingerprint() uint64 {
+	h := fnv.New64a()
+	var buf [8]byte
+	for _, hash := range m.keys {
+		binary.BigEndian.PutUint64(buf[:], hash)
+		h.Write(buf[:])
+		h.Write([]byte(m.hashMap[hash]))
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
+// Snapshot 将哈希环导出为紧凑的二进制快照，包括虚拟节点倍数、成员及其权重和指纹。
+// 哈希函数无法序列化，Restore 时需要提供相同的哈希函数，指纹用于校验这一点。
+func (m *Map) Snapshot() []byte {
+	buf := []byte{snapshotVersion}
+	buf = binary.AppendUvarint(buf, uint64(m.replicas))
+	buf = binary.AppendUvarint(buf, uint64(len(m.nodes)))
+	for _, node := range m.Nodes() {
+		buf = binary.AppendUvarint(buf, uint64(len(node)))
+		buf = append(buf, node...)
+		buf = binary.AppendUvarint(buf, uint64(m.nodes[node]))
+	}
+	return binary.BigEndian.AppendUint64(buf, m.Fingerprint())
+}
+
+var errBadSnapshot = errors.New("consistenthash: malformed snapshot")
+
+// Restore 使用哈希函数 fn 从快照重建哈希环。
+// 如果重建后的指纹与快照中的不一致（通常是哈希函数不同），返回错误。
+func Restore(data []byte, fn Hash) (*Map, error) {
+	if len(data) == 0 || data[0] != snapshotVersion {
+		return nil, errBadSnapshot
+	}
+	data = data[1:]
+	next := func() (uint64, bool) {
+		v, n := binary.Uvarint(data)
+		if n <= 0 {
+			return 0, false
+		}
+		data = data[n:]
+		return v, true
+	}
+
+	replicas, ok := next()
+	if !ok || replicas > maxSnapshotVirtualNodes {
+		return nil, errBadSnapshot
+	}
+	count, ok := next()
+	if !ok {
+		return nil, errBadSnapshot
+	}
+	m := New(int(replicas), fn)
+	var added []uint64
+	collided := false
+	var virtual uint64 // 虚拟节点总数
+	for i := uint64(0); i < count; i++ {
+		size, ok := next()
+		if !ok || uint64(len(data)) < size {
+			return nil, errBadSnapshot
+		}
+		node := string(data[:size])
+		data = data[size:]
+		weight, ok := next()
+		if !ok || weight > maxSnapshotVirtualNodes {
+			return nil, errBadSnapshot
+		}
+		// 两者都不超过 2^22，乘积不会溢出
+		if virtual += replicas * max(weight, 1); virtual > maxSnapshotVirtualNodes {
+			return nil, errBadSnapshot
+		}
+		var c bool
+		added, c = m.add(added, node, int(weight))
+		collided = collided || c
+	}
+	m.insert(added, collided)
+
+	if len(data) != 8 {
+		return nil, errBadSnapshot
+	}
+	if fp := binary.BigEndian.Uint64(data); fp != m.Fingerprint() {
+		return nil, fmt.Errorf("consistenthash: snapshot fingerprint %016x does not match restored ring %016x", fp, m.Fingerprint())
+	}
+	return m, nil
+}
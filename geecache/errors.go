@@ -0,0 +1,118 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	pb "geecache/geecachepb"
+	"log"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+)
+
+// Error 是带有错误码的错误，错误码会在节点之间传递，
+// 因此调用者可以区分数据源中不存在的 key、过载的节点和不存在的 Group。
+// 使用 errors.Is 与 ErrNotFound 等比较时只比较错误码。
+type Error struct {
+	Code    pb.ErrorCode
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	return strings.ToLower(strings.ReplaceAll(e.Code.String(), "_", " "))
+}
+
+// Is 判断 target 是否为错误码相同的 *Error
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+var (
+	// ErrNotFound 表示 key 在数据源中不存在，Getter 可以用 %w 包装它返回
+	ErrNotFound = &Error{Code: pb.ErrorCode_NOT_FOUND}
+	// ErrUnavailable 表示节点或数据源暂时无法处理请求，例如过载
+	ErrUnavailable = &Error{Code: pb.ErrorCode_UNAVAILABLE}
+	// ErrTimeout 表示加载没有在限定时间内完成
+	ErrTimeout = &Error{Code: pb.ErrorCode_TIMEOUT}
+	// ErrBadRequest 表示请求本身无效，例如 key 为空或 Group 不存在
+	ErrBadRequest = &Error{Code: pb.ErrorCode_BAD_REQUEST}
+)
+
+// errorf 返回错误码为 code 的错误
+func errorf(code pb.ErrorCode, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// codeOf 返回 err 的错误码。
+// 没有错误码的 context 错误视为超时或不可用，其余错误为 INTERNAL。
+func codeOf(err error) pb.ErrorCode {
+	var e *Error
+	switch {
+	case err == nil:
+		return pb.ErrorCode_OK
+	case errors.As(err, &e):
+		return e.Code
+	case errors.Is(err, context.DeadlineExceeded):
+		return pb.ErrorCode_TIMEOUT
+	case errors.Is(err, context.Canceled):
+		return pb.ErrorCode_UNAVAILABLE
+	}
+	return pb.ErrorCode_INTERNAL
+}
+
+// remoteMessage 返回发给远程调用者的错误信息。
+// INTERNAL 错误可能包含内部细节（例如 *singleflight.PanicError 中的调用栈），
+// 只在本地记录，远程调用者只收到通用的信息。
+func remoteMessage(code pb.ErrorCode, err error) string {
+	if code == pb.ErrorCode_INTERNAL {
+		log.Println("[GeeCache] internal error:", err)
+		return "internal error"
+	}
+	return err.Error()
+}
+
+// isPeerError 判断 err 是否由节点返回，而不是无法联系节点的传输错误。
+// PeerGetter 应当将节点返回的错误转换为 *Error，其余错误均视为传输错误。
+func isPeerError(err error) bool {
+	var e *Error
+	return errors.As(err, &e)
+}
+
+// httpStatus 返回错误码对应的 HTTP 状态码
+func httpStatus(code pb.ErrorCode) int {
+	switch code {
+	case pb.ErrorCode_OK:
+		return http.StatusOK
+	case pb.ErrorCode_NOT_FOUND:
+		return http.StatusNotFound
+	case pb.ErrorCode_UNAVAILABLE:
+		return http.StatusServiceUnavailable
+	case pb.ErrorCode_TIMEOUT:
+		return http.StatusGatewayTimeout
+	case pb.ErrorCode_BAD_REQUEST:
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// grpcCode 返回错误码对应的 gRPC 状态码
+func grpcCode(code pb.ErrorCode) codes.Code {
+	switch code {
+	case pb.ErrorCode_OK:
+		return codes.OK
+	case pb.ErrorCode_NOT_FOUND:
+		return codes.NotFound
+	case pb.ErrorCode_UNAVAILABLE:
+		return codes.Unavailable
+	case pb.ErrorCode_TIMEOUT:
+		return codes.DeadlineExceeded
+	case pb.ErrorCode_BAD_REQUEST:
+		return codes.InvalidArgument
+	}
+	return codes.Internal
+}
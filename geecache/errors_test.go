@@ -0,0 +1,124 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "geecache/geecachepb"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestErrorIs(t *testing.T) {
+	err := fmt.Errorf("Tom not exist: %w", ErrNotFound)
+	if !errors.Is(err, ErrNotFound) || errors.Is(err, ErrUnavailable) {
+		t.Fatalf("errors.Is does not compare error codes")
+	}
+	if !errors.Is(errorf(pb.ErrorCode_TIMEOUT, "slow"), ErrTimeout) {
+		t.Fatalf("errors.Is ignores the message of the target")
+	}
+	if ErrBadRequest.Error() != "bad request" {
+		t.Fatalf("ErrBadRequest = %q", ErrBadRequest.Error())
+	}
+
+	tests := []struct {
+		err  error
+		code pb.ErrorCode
+	}{
+		{nil, pb.ErrorCode_OK},
+		{err, pb.ErrorCode_NOT_FOUND},
+		{context.DeadlineExceeded, pb.ErrorCode_TIMEOUT},
+		{context.Canceled, pb.ErrorCode_UNAVAILABLE},
+		{errors.New("boom"), pb.ErrorCode_INTERNAL},
+	}
+	for _, tt := range tests {
+		if code := codeOf(tt.err); code != tt.code {
+			t.Errorf("codeOf(%v) = %v, want %v", tt.err, code, tt.code)
+		}
+	}
+}
+
+func TestHTTPErrorCodes(t *testing.T) {
+	NewGroup("http-errors", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		switch key {
+		case "missing":
+			return nil, fmt.Errorf("%s not exist: %w", key, ErrNotFound)
+		case "busy":
+			return nil, ErrUnavailable
+		}
+		return nil, errors.New("origin broken")
+	}))
+	pool := NewHTTPPool("self")
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+	peer := &httpGetter{pool: pool, baseURL: srv.URL + defaultBasePath}
+
+	tests := []struct {
+		group, key string
+		want       error
+	}{
+		{"http-errors", "missing", ErrNotFound},
+		{"http-errors", "busy", ErrUnavailable},
+		{"no-such-group", "key", ErrBadRequest},
+		{"http-errors", "broken", &Error{Code: pb.ErrorCode_INTERNAL}},
+	}
+	for _, tt := range tests {
+		err := peer.Get(&pb.Request{Group: tt.group, Key: tt.key}, &pb.Response{})
+		if !errors.Is(err, tt.want) {
+			t.Errorf("Get(%s/%s) = %v, want %v", tt.group, tt.key, err, tt.want)
+		}
+	}
+
+	// INTERNAL 错误的细节不发给远程调用者
+	err := peer.Get(&pb.Request{Group: "http-errors", Key: "broken"}, &pb.Response{})
+	if err == nil || err.Error() != "internal error" {
+		t.Errorf("Get of a broken key = %v, want a generic internal error", err)
+	}
+
+	srv.Close()
+	err = peer.Get(&pb.Request{Group: "http-errors", Key: "missing"}, &pb.Response{})
+	if err == nil || isPeerError(err) {
+		t.Fatalf("Get from a stopped peer = %v, want a transport error", err)
+	}
+}
+
+// staticPicker 将所有 key 交给 peer
+type staticPicker struct{ peer PeerGetter }
+
+func (p staticPicker) PickPeer(key string) (PeerGetter, bool) { return p.peer, true }
+
+// errPeer 的 Get 总是返回 err
+type errPeer struct{ err error }
+
+func (p errPeer) Get(in *pb.Request, out *pb.Response) error { return p.err }
+
+func TestLoadFallback(t *testing.T) {
+	tests := []struct {
+		name      string
+		peerErr   error
+		wantLocal bool
+	}{
+		{"peer-not-found", errorf(pb.ErrorCode_NOT_FOUND, "Tom not exist"), false},
+		{"peer-unavailable", ErrUnavailable, false},
+		{"transport", errors.New("connection refused"), true},
+	}
+	for _, tt := range tests {
+		loads := 0
+		g := NewGroup("fallback-"+tt.name, 2<<10, GetterFunc(func(key string) ([]byte, error) {
+			loads++
+			return []byte("origin"), nil
+		}))
+		g.RegisterPeers(staticPicker{errPeer{tt.peerErr}})
+
+		v, err := g.Get("Tom")
+		if local := loads > 0; local != tt.wantLocal {
+			t.Errorf("%s: loaded locally %v, want %v", tt.name, local, tt.wantLocal)
+		}
+		if tt.wantLocal && (err != nil || v.String() != "origin") {
+			t.Errorf("%s: Get = %q, %v", tt.name, v, err)
+		}
+		if !tt.wantLocal && !errors.Is(err, tt.peerErr) {
+			t.Errorf("%s: Get error = %v, want %v", tt.name, err, tt.peerErr)
+		}
+	}
+}
@@ -1,10 +1,10 @@
 package geecache
 
 import (
-	"fmt"
+	"context"
 	"time"
 
-	// pb "geecache/geecachepb"
+	pb "geecache/geecachepb"
 	"geecache/singleflight"
 	"log"
 	"sync"
@@ -16,7 +16,18 @@ type Group struct {
 	getter    Getter
 	mainCache cache
 	peers     PeerPicker
-	loader    *singleflight.Group
+	loader    *singleflight.Group[string, ByteView]
+	leases    leaseTable    // 本节点作为管理者发放的租约
+	leaseTTL  time.Duration // 申请租约的有效期，0 表示不申请租约
+
+	loadsMu sync.Mutex              // 保护 loads，使写入缓存与 Remove 互斥
+	loads   map[string]*pendingLoad // 正在从数据源加载的 key
+}
+
+// pendingLoad 是一次进行中的加载，加载期间 key 被 Remove 时标记为 removed，
+// 其结果可能已经过期，不写入缓存
+type pendingLoad struct {
+	removed bool
 }
 
 // Getter 负责为指定的键加载数据
@@ -32,6 +43,12 @@ func (f GetterFunc) Get(key string) ([]byte, error) {
 	return f(key)
 }
 
+// ContextGetter 是可选的接口，Getter 实现它后可以在所有等待的调用者都离开时停止加载
+type ContextGetter interface {
+	Getter
+	GetContext(ctx context.Context, key string) ([]byte, error)
+}
+
 var (
 	mu     sync.RWMutex
 	groups = make(map[string]*Group)
@@ -48,7 +65,7 @@ func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
 		name:      name,
 		getter:    getter,
 		mainCache: cache{cacheBytes: cacheBytes, expiration: 1 * time.Minute}, // 默认设置5分组，为防止缓存雪崩，可以增加随机数
-		loader:    &singleflight.Group{},
+		loader:    &singleflight.Group[string, ByteView]{},
 	}
 	groups[name] = g
 	return g
@@ -64,8 +81,14 @@ func GetGroup(name string) *Group {
 
 // Get 从缓存中获取指定键的值
 func (g *Group) Get(key string) (ByteView, error) {
+	return g.GetContext(context.Background(), key)
+}
+
+// GetContext 与 Get 相同，但在 ctx 结束时不再等待加载结果，返回 ctx.Err()。
+// 同一个键的加载只有在所有等待它的调用者都离开后才会被取消。
+func (g *Group) GetContext(ctx context.Context, key string) (ByteView, error) {
 	if key == "" {
-		return ByteView{}, fmt.Errorf("key is required")
+		return ByteView{}, errorf(pb.ErrorCode_BAD_REQUEST, "key is required")
 	}
 
 	if v, ok := g.mainCache.get(key); ok {
@@ -73,7 +96,20 @@ func (g *Group) Get(key string) (ByteView, error) {
 		return v, nil
 	}
 
-	return g.load(key)
+	return g.load(ctx, key)
+}
+
+// Remove 使指定键在本地缓存中失效，
+// 并让正在进行中的加载不再被之后的 Get 复用，从而强制重新加载。
+func (g *Group) Remove(key string) {
+	g.loadsMu.Lock()
+	defer g.loadsMu.Unlock()
+	if l, ok := g.loads[key]; ok {
+		l.removed = true
+		delete(g.loads, key)
+	}
+	g.loader.Forget(key)
+	g.mainCache.remove(key)
 }
 
 // RegisterPeers 用于注册一个 PeerPicker，用于选择远程节点。
@@ -84,53 +120,96 @@ func (g *Group) RegisterPeers(peers PeerPicker) {
 	g.peers = peers
 }
 
-func (g *Group) load(key string) (value ByteView, err error) {
-
-	viewi, err := g.loader.Do(key, func() (interface{}, error) {
+func (g *Group) load(ctx context.Context, key string) (value ByteView, err error) {
+	value, err, _ = g.loader.DoContext(ctx, key, func(ctx context.Context) (ByteView, error) {
+		l := g.startLoad(key)
+		defer g.finishLoad(key, l)
 		if g.peers != nil {
+			var unreachable PeerGetter
 			if peer, ok := g.peers.PickPeer(key); ok {
-				if value, err = g.getFromPeer(peer, key); err == nil {
-					return value, nil
+				value, err := g.getFromPeer(peer, key)
+				if err == nil || isPeerError(err) {
+					// 节点给出了结果，只有无法联系节点时才回退到本地加载
+					return value, err
 				}
 				log.Println("[GeeCache] Failed to get from peer", err)
+				unreachable = peer
+			}
+			if g.leaseTTL > 0 {
+				if holder := g.leaseHolder(key, unreachable); holder != nil {
+					value, err := g.getFromPeer(holder, key)
+					if err == nil || isPeerError(err) {
+						return value, err
+					}
+					log.Println("[GeeCache] Failed to get from lease holder", err)
+				}
 			}
 		}
 
-		return g.getLocally(key)
+		return g.getLocally(ctx, key, l)
 	})
-
-	if err == nil {
-		return viewi.(ByteView), nil
-	}
 	return
 }
 
 // 分布式场景 可以调用 getFromPeer 从其他节点获取
-func (g *Group) getLocally(key string) (ByteView, error) {
-	bytes, err := g.getter.Get(key)
+func (g *Group) getLocally(ctx context.Context, key string, l *pendingLoad) (ByteView, error) {
+	var bytes []byte
+	var err error
+	if cg, ok := g.getter.(ContextGetter); ok {
+		bytes, err = cg.GetContext(ctx, key)
+	} else {
+		bytes, err = g.getter.Get(key)
+	}
 	if err != nil {
 		return ByteView{}, err
 
 	}
 	value := ByteView{b: cloneBytes(bytes)}
-	g.populateCache(key, value)
+	g.populateCache(key, value, l)
 	return value, nil
 }
 
-func (g *Group) populateCache(key string, value ByteView) {
+// populateCache 将加载结果写入缓存，
+// 加载开始后发生过 Remove 时结果可能已经过期，不写入缓存
+func (g *Group) populateCache(key string, value ByteView, l *pendingLoad) {
+	g.loadsMu.Lock()
+	defer g.loadsMu.Unlock()
+	if l.removed {
+		return
+	}
 	g.mainCache.add(key, value)
 }
 
+// startLoad 登记 key 的一次加载
+func (g *Group) startLoad(key string) *pendingLoad {
+	g.loadsMu.Lock()
+	defer g.loadsMu.Unlock()
+	if g.loads == nil {
+		g.loads = make(map[string]*pendingLoad)
+	}
+	l := &pendingLoad{}
+	g.loads[key] = l
+	return l
+}
+
+// finishLoad 注销 startLoad 登记的加载
+func (g *Group) finishLoad(key string, l *pendingLoad) {
+	g.loadsMu.Lock()
+	defer g.loadsMu.Unlock()
+	if g.loads[key] == l {
+		delete(g.loads, key)
+	}
+}
+
 func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
-	// req := &pb.Request{
-	// 	Group: g.name,
-	// 	Key:   key,
-	// }
-	// res := &pb.Response{}
-	// err := peer.Get(req, res)
-	// if err != nil {
-	// 	return ByteView{}, err
-	// }
-	// return ByteView{b: res.Value}, nil
-	return ByteView{}, nil
+	req := &pb.Request{
+		Group: g.name,
+		Key:   key,
+	}
+	res := &pb.Response{}
+	err := peer.Get(req, res)
+	if err != nil {
+		return ByteView{}, err
+	}
+	return ByteView{b: res.Value}, nil
 }
@@ -0,0 +1,144 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingGetter 在 release 关闭或 ctx 结束前阻塞
+type blockingGetter struct {
+	calls     int32
+	release   chan struct{}
+	cancelled chan struct{}
+}
+
+func (b *blockingGetter) Get(key string) ([]byte, error) {
+	return b.GetContext(context.Background(), key)
+}
+
+func (b *blockingGetter) GetContext(ctx context.Context, key string) ([]byte, error) {
+	atomic.AddInt32(&b.calls, 1)
+	select {
+	case <-b.release:
+		return []byte("value of " + key), nil
+	case <-ctx.Done():
+		close(b.cancelled)
+		return nil, ctx.Err()
+	}
+}
+
+func TestGetContext(t *testing.T) {
+	getter := &blockingGetter{release: make(chan struct{}), cancelled: make(chan struct{})}
+	g := NewGroup("get-context", 2<<10, getter)
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	defer cancel1()
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	go func() {
+		_, err := g.GetContext(ctx1, "key")
+		errs <- err
+	}()
+	go func() {
+		_, err := g.GetContext(ctx2, "key")
+		errs <- err
+	}()
+	for atomic.LoadInt32(&getter.calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// 一个调用者离开，加载仍在为另一个调用者进行
+	cancel2()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled caller got %v", err)
+	}
+	select {
+	case <-getter.cancelled:
+		t.Fatalf("load cancelled while a caller is still waiting")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(getter.release)
+	if err := <-errs; err != nil {
+		t.Fatalf("remaining caller got %v", err)
+	}
+	if v, err := g.Get("key"); err != nil || v.String() != "value of key" {
+		t.Fatalf("cached value = %v, %v", v, err)
+	}
+	if calls := atomic.LoadInt32(&getter.calls); calls != 1 {
+		t.Fatalf("getter called %d times, want 1", calls)
+	}
+}
+
+func TestGetContextAllCallersLeave(t *testing.T) {
+	getter := &blockingGetter{release: make(chan struct{}), cancelled: make(chan struct{})}
+	g := NewGroup("get-context-leave", 2<<10, getter)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := g.GetContext(ctx, "key"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GetContext got %v, want context.DeadlineExceeded", err)
+	}
+	select {
+	case <-getter.cancelled:
+	case <-time.After(time.Second):
+		t.Fatalf("load not cancelled after its only caller left")
+	}
+}
+
+func TestRemoveDuringLoad(t *testing.T) {
+	getter := &blockingGetter{release: make(chan struct{}), cancelled: make(chan struct{})}
+	g := NewGroup("remove-during-load", 2<<10, getter)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := g.Get("key")
+		done <- err
+	}()
+	for atomic.LoadInt32(&getter.calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// 加载开始后失效的键，加载结果不能写回缓存
+	g.Remove("key")
+	close(getter.release)
+	if err := <-done; err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if _, err := g.Get("key"); err != nil {
+		t.Fatalf("Get after Remove: %v", err)
+	}
+	if calls := atomic.LoadInt32(&getter.calls); calls != 2 {
+		t.Fatalf("getter called %d times, want 2: stale load cached after Remove", calls)
+	}
+}
+
+func TestRemoveOtherKeyDuringLoad(t *testing.T) {
+	getter := &blockingGetter{release: make(chan struct{}), cancelled: make(chan struct{})}
+	g := NewGroup("remove-other-key", 2<<10, getter)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := g.Get("b")
+		done <- err
+	}()
+	for atomic.LoadInt32(&getter.calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// 失效其他 key 不影响进行中的加载写入缓存
+	g.Remove("unrelated")
+	close(getter.release)
+	if err := <-done; err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if _, err := g.Get("b"); err != nil {
+		t.Fatalf("second Get: %v", err)
+	}
+	if calls := atomic.LoadInt32(&getter.calls); calls != 1 {
+		t.Fatalf("getter called %d times, want 1: load not cached after removing another key", calls)
+	}
+}
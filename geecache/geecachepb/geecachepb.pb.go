@@ -20,6 +20,43 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 
+type ErrorCode int32
+
+const (
+	ErrorCode_OK          ErrorCode = 0
+	ErrorCode_NOT_FOUND   ErrorCode = 1
+	ErrorCode_UNAVAILABLE ErrorCode = 2
+	ErrorCode_TIMEOUT     ErrorCode = 3
+	ErrorCode_BAD_REQUEST ErrorCode = 4
+	ErrorCode_INTERNAL    ErrorCode = 5
+)
+
+var ErrorCode_name = map[int32]string{
+	0: "OK",
+	1: "NOT_FOUND",
+	2: "UNAVAILABLE",
+	3: "TIMEOUT",
+	4: "BAD_REQUEST",
+	5: "INTERNAL",
+}
+
+var ErrorCode_value = map[string]int32{
+	"OK":          0,
+	"NOT_FOUND":   1,
+	"UNAVAILABLE": 2,
+	"TIMEOUT":     3,
+	"BAD_REQUEST": 4,
+	"INTERNAL":    5,
+}
+
+func (x ErrorCode) String() string {
+	return proto.EnumName(ErrorCode_name, int32(x))
+}
+
+func (ErrorCode) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_889d0a4ad37a0d42, []int{0}
+}
+
 type Request struct {
 	Group                string   `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
 	Key                  string   `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
@@ -68,10 +105,12 @@ func (m *Request) GetKey() string {
 }
 
 type Response struct {
-	Value                []byte   `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+	Value                []byte    `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"`
+	ErrorCode            ErrorCode `protobuf:"varint,2,opt,name=error_code,json=errorCode,proto3,enum=geecachepb.ErrorCode" json:"error_code,omitempty"`
+	Error                string    `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
+	XXX_unrecognized     []byte    `json:"-"`
+	XXX_sizecache        int32     `json:"-"`
 }
 
 func (m *Response) Reset()         { *m = Response{} }
@@ -106,23 +145,171 @@ func (m *Response) GetValue() []byte {
 	return nil
 }
 
+func (m *Response) GetErrorCode() ErrorCode {
+	if m != nil {
+		return m.ErrorCode
+	}
+	return ErrorCode_OK
+}
+
+func (m *Response) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+type LeaseRequest struct {
+	Group                string   `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	Key                  string   `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	Holder               string   `protobuf:"bytes,3,opt,name=holder,proto3" json:"holder,omitempty"`
+	TtlMs                int64    `protobuf:"varint,4,opt,name=ttl_ms,json=ttlMs,proto3" json:"ttl_ms,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *LeaseRequest) Reset()         { *m = LeaseRequest{} }
+func (m *LeaseRequest) String() string { return proto.CompactTextString(m) }
+func (*LeaseRequest) ProtoMessage()    {}
+func (*LeaseRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_889d0a4ad37a0d42, []int{2}
+}
+
+func (m *LeaseRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_LeaseRequest.Unmarshal(m, b)
+}
+func (m *LeaseRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_LeaseRequest.Marshal(b, m, deterministic)
+}
+func (m *LeaseRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_LeaseRequest.Merge(m, src)
+}
+func (m *LeaseRequest) XXX_Size() int {
+	return xxx_messageInfo_LeaseRequest.Size(m)
+}
+func (m *LeaseRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_LeaseRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_LeaseRequest proto.InternalMessageInfo
+
+func (m *LeaseRequest) GetGroup() string {
+	if m != nil {
+		return m.Group
+	}
+	return ""
+}
+
+func (m *LeaseRequest) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+func (m *LeaseRequest) GetHolder() string {
+	if m != nil {
+		return m.Holder
+	}
+	return ""
+}
+
+func (m *LeaseRequest) GetTtlMs() int64 {
+	if m != nil {
+		return m.TtlMs
+	}
+	return 0
+}
+
+type LeaseResponse struct {
+	Granted              bool     `protobuf:"varint,1,opt,name=granted,proto3" json:"granted,omitempty"`
+	Holder               string   `protobuf:"bytes,2,opt,name=holder,proto3" json:"holder,omitempty"`
+	TtlMs                int64    `protobuf:"varint,3,opt,name=ttl_ms,json=ttlMs,proto3" json:"ttl_ms,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *LeaseResponse) Reset()         { *m = LeaseResponse{} }
+func (m *LeaseResponse) String() string { return proto.CompactTextString(m) }
+func (*LeaseResponse) ProtoMessage()    {}
+func (*LeaseResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_889d0a4ad37a0d42, []int{3}
+}
+
+func (m *LeaseResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_LeaseResponse.Unmarshal(m, b)
+}
+func (m *LeaseResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_LeaseResponse.Marshal(b, m, deterministic)
+}
+func (m *LeaseResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_LeaseResponse.Merge(m, src)
+}
+func (m *LeaseResponse) XXX_Size() int {
+	return xxx_messageInfo_LeaseResponse.Size(m)
+}
+func (m *LeaseResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_LeaseResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_LeaseResponse proto.InternalMessageInfo
+
+func (m *LeaseResponse) GetGranted() bool {
+	if m != nil {
+		return m.Granted
+	}
+	return false
+}
+
+func (m *LeaseResponse) GetHolder() string {
+	if m != nil {
+		return m.Holder
+	}
+	return ""
+}
+
+func (m *LeaseResponse) GetTtlMs() int64 {
+	if m != nil {
+		return m.TtlMs
+	}
+	return 0
+}
+
 func init() {
+	proto.RegisterEnum("geecachepb.ErrorCode", ErrorCode_name, ErrorCode_value)
 	proto.RegisterType((*Request)(nil), "geecachepb.Request")
 	proto.RegisterType((*Response)(nil), "geecachepb.Response")
+	proto.RegisterType((*LeaseRequest)(nil), "geecachepb.LeaseRequest")
+	proto.RegisterType((*LeaseResponse)(nil), "geecachepb.LeaseResponse")
 }
 
 func init() { proto.RegisterFile("geecachepb.proto", fileDescriptor_889d0a4ad37a0d42) }
 
 var fileDescriptor_889d0a4ad37a0d42 = []byte{
-	// 148 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0x12, 0x48, 0x4f, 0x4d, 0x4d,
-	0x4e, 0x4c, 0xce, 0x48, 0x2d, 0x48, 0xd2, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0xe2, 0x42, 0x88,
-	0x28, 0x19, 0x72, 0xb1, 0x07, 0xa5, 0x16, 0x96, 0xa6, 0x16, 0x97, 0x08, 0x89, 0x70, 0xb1, 0xa6,
-	0x17, 0xe5, 0x97, 0x16, 0x48, 0x30, 0x2a, 0x30, 0x6a, 0x70, 0x06, 0x41, 0x38, 0x42, 0x02, 0x5c,
-	0xcc, 0xd9, 0xa9, 0x95, 0x12, 0x4c, 0x60, 0x31, 0x10, 0x53, 0x49, 0x81, 0x8b, 0x23, 0x28, 0xb5,
-	0xb8, 0x20, 0x3f, 0xaf, 0x38, 0x15, 0xa4, 0xa7, 0x2c, 0x31, 0xa7, 0x34, 0x15, 0xac, 0x87, 0x27,
-	0x08, 0xc2, 0x31, 0xb2, 0xe3, 0xe2, 0x72, 0x07, 0x69, 0x76, 0x06, 0x59, 0x22, 0x64, 0xc0, 0xc5,
-	0xec, 0x9e, 0x5a, 0x22, 0x24, 0xac, 0x87, 0xe4, 0x10, 0xa8, 0x9d, 0x52, 0x22, 0xa8, 0x82, 0x10,
-	0x53, 0x93, 0xd8, 0xc0, 0xee, 0x34, 0x06, 0x04, 0x00, 0x00, 0xff, 0xff, 0x5c, 0xd5, 0xdd, 0x09,
-	0xbb, 0x00, 0x00, 0x00,
-}
\ No newline at end of file
+	// 356 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x52, 0x41, 0x8f, 0x9a, 0x40,
+	0x18, 0x2d, 0x20, 0x28, 0x9f, 0xda, 0x4e, 0xa6, 0xda, 0x50, 0x4f, 0x86, 0x93, 0xe9, 0xc1, 0xb4,
+	0xb6, 0xc7, 0x5e, 0x50, 0xa9, 0x31, 0x45, 0x48, 0xa7, 0xd0, 0xf4, 0x46, 0x50, 0xbe, 0x68, 0x52,
+	0xea, 0x50, 0x18, 0x9b, 0x6c, 0xb2, 0x3f, 0x7e, 0xc3, 0x80, 0xbb, 0x6c, 0xb2, 0x7b, 0xd8, 0xdb,
+	0xbc, 0xef, 0xe5, 0xbd, 0xef, 0x7b, 0x2f, 0x03, 0xe4, 0x88, 0x78, 0x48, 0x0e, 0x27, 0xcc, 0xf7,
+	0xf3, 0xbc, 0xe0, 0x82, 0x53, 0x78, 0x98, 0xd8, 0x9f, 0xa0, 0xcb, 0xf0, 0xdf, 0x05, 0x4b, 0x41,
+	0x47, 0xa0, 0x1f, 0x0b, 0x7e, 0xc9, 0x2d, 0x65, 0xaa, 0xcc, 0x4c, 0x56, 0x03, 0x4a, 0x40, 0xfb,
+	0x83, 0x37, 0x96, 0x2a, 0x67, 0xd5, 0xd3, 0xce, 0xa0, 0xc7, 0xb0, 0xcc, 0xf9, 0xb9, 0xc4, 0x4a,
+	0xf3, 0x3f, 0xc9, 0x2e, 0x28, 0x35, 0x03, 0x56, 0x03, 0xfa, 0x05, 0x00, 0x8b, 0x82, 0x17, 0xf1,
+	0x81, 0xa7, 0x28, 0xa5, 0xaf, 0x17, 0xe3, 0x79, 0xeb, 0x0e, 0xb7, 0x62, 0x57, 0x3c, 0x45, 0x66,
+	0xe2, 0xf5, 0x59, 0x79, 0x49, 0x60, 0x69, 0xf5, 0x7e, 0x09, 0x6c, 0x84, 0x81, 0x87, 0x49, 0x89,
+	0x2f, 0xbc, 0x92, 0xbe, 0x03, 0xe3, 0xc4, 0xb3, 0x14, 0xaf, 0x76, 0x0d, 0xa2, 0x63, 0x30, 0x84,
+	0xc8, 0xe2, 0xbf, 0xa5, 0xd5, 0x99, 0x2a, 0x33, 0x8d, 0xe9, 0x42, 0x64, 0xbb, 0xd2, 0xfe, 0x0d,
+	0xc3, 0x66, 0x4d, 0x93, 0xcc, 0x82, 0xee, 0xb1, 0x48, 0xce, 0x02, 0x53, 0xb9, 0xa9, 0xc7, 0xae,
+	0xb0, 0xe5, 0xac, 0x3e, 0xe3, 0xac, 0xb5, 0x9c, 0x3f, 0xc4, 0x60, 0xde, 0xc7, 0xa5, 0x06, 0xa8,
+	0xc1, 0x77, 0xf2, 0x8a, 0x0e, 0xc1, 0xf4, 0x83, 0x30, 0xfe, 0x16, 0x44, 0xfe, 0x9a, 0x28, 0xf4,
+	0x0d, 0xf4, 0x23, 0xdf, 0xf9, 0xe5, 0x6c, 0x3d, 0x67, 0xe9, 0xb9, 0x44, 0xa5, 0x7d, 0xe8, 0x86,
+	0xdb, 0x9d, 0x1b, 0x44, 0x21, 0xd1, 0x2a, 0x76, 0xe9, 0xac, 0x63, 0xe6, 0xfe, 0x88, 0xdc, 0x9f,
+	0x21, 0xe9, 0xd0, 0x01, 0xf4, 0xb6, 0x7e, 0xe8, 0x32, 0xdf, 0xf1, 0x88, 0xbe, 0xb8, 0x05, 0xd8,
+	0x54, 0x25, 0xac, 0xaa, 0x72, 0xe9, 0x47, 0xd0, 0x36, 0x28, 0xe8, 0xdb, 0x76, 0xdd, 0x4d, 0x77,
+	0x93, 0xd1, 0xe3, 0x61, 0x93, 0xf4, 0x2b, 0xe8, 0x32, 0x3a, 0xb5, 0xda, 0x74, 0xbb, 0xf4, 0xc9,
+	0xfb, 0x27, 0x98, 0x5a, 0xbd, 0x37, 0xe4, 0x9f, 0xfa, 0x7c, 0x37, 0x00, 0x6f, 0x85, 0xc5, 0x71,
+	0x67, 0x02, 0x00, 0x00,
+}
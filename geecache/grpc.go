@@ -0,0 +1,279 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	"geecache/consistenthash"
+	pb "geecache/geecachepb"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// ringMetadata carries the sender's ring fingerprint in hex,
+	// like ringHeader does for HTTP.
+	ringMetadata = "x-geecache-ring"
+	// errorCodeMetadata is the trailer carrying the name of the
+	// pb.ErrorCode of a failed request. Its presence tells an error
+	// reported by the peer from a transport failure.
+	errorCodeMetadata = "x-geecache-error-code"
+)
+
+// GRPCPool implements PeerPicker for a pool of gRPC peers.
+// Peers are named by their address, e.g. "10.0.0.2:8008".
+// It keeps one connection per peer, shared by all requests to the peer.
+type GRPCPool struct {
+	peerRing
+	timeout time.Duration
+}
+
+// GRPCPoolOptions are the configurations of a GRPCPool.
+type GRPCPoolOptions struct {
+	// Replicas is the number of virtual nodes per peer on the default ring.
+	// If zero, defaultReplicas is used. Ignored if Placement is set.
+	Replicas int
+
+	// Placement returns an empty placement that decides which peer owns
+	// a key, see HTTPPoolOptions.Placement.
+	Placement func() consistenthash.Placement
+
+	// HashFn is the hash function of the default ring, see
+	// HTTPPoolOptions.HashFn. Ignored if Placement is set.
+	HashFn consistenthash.Hash
+
+	// LoadBound enables consistent hashing with bounded loads if positive,
+	// see HTTPPoolOptions.LoadBound.
+	LoadBound float64
+
+	// Timeout is the deadline of a request to another peer.
+	// If zero, defaultTimeout is used.
+	Timeout time.Duration
+
+	// DialOptions are used to connect to other peers.
+	// If empty, connections use no transport security.
+	DialOptions []grpc.DialOption
+
+	// HealthCheck configures the ejection of peers that keep failing,
+	// see HTTPPoolOptions.HealthCheck. Probes are Get requests for no
+	// group, which a serving peer answers with a bad request error.
+	HealthCheck HealthCheckOptions
+}
+
+// NewGRPCPool initializes a gRPC pool of peers.
+func NewGRPCPool(self string) *GRPCPool {
+	return NewGRPCPoolOpts(self, GRPCPoolOptions{})
+}
+
+// NewGRPCPoolOpts initializes a gRPC pool of peers with the given options.
+func NewGRPCPoolOpts(self string, o GRPCPoolOptions) *GRPCPool {
+	p := &GRPCPool{
+		peerRing: peerRing{
+			self:         self,
+			newPlacement: newPlacementFunc(o.Placement, o.Replicas, o.HashFn),
+			loadBound:    o.LoadBound,
+			healthOpts:   o.HealthCheck.withDefaults(),
+		},
+		timeout: o.Timeout,
+	}
+	if p.timeout == 0 {
+		p.timeout = defaultTimeout
+	}
+	dialOptions := o.DialOptions
+	if len(dialOptions) == 0 {
+		dialOptions = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	p.newGetter = func(peer string) poolGetter {
+		// NewClient does not connect until the first request,
+		// and reconnects by itself after the connection breaks.
+		conn, err := grpc.NewClient(peer, dialOptions...)
+		return &grpcGetter{pool: p, addr: peer, conn: conn, err: err}
+	}
+	p.closeGetter = func(g poolGetter) {
+		if conn := g.(*grpcGetter).conn; conn != nil {
+			conn.Close()
+		}
+	}
+	if o.HealthCheck.Interval > 0 {
+		p.startProbes(o.HealthCheck.Interval, p.probeHealth)
+	}
+	return p
+}
+
+// probeHealth checks that peer answers requests.
+func (p *GRPCPool) probeHealth(peer string) error {
+	p.mu.Lock()
+	g, ok := p.getters[peer]
+	p.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	err := g.(*grpcGetter).call(pb.GroupCache_Get_FullMethodName, &pb.Request{}, &pb.Response{})
+	return transportError(err)
+}
+
+// Register registers the GroupCache service on s, serving the groups
+// created by NewGroup to the other peers.
+func (p *GRPCPool) Register(s grpc.ServiceRegistrar) {
+	pb.RegisterGroupCacheServer(s, &grpcServer{pool: p})
+}
+
+// Close stops the health probes, if any, closes the connections to all
+// peers and removes them from the pool.
+func (p *GRPCPool) Close() error {
+	p.stopProbes()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closeLocked(p.getters)
+	p.peers = nil
+	p.getters = nil
+	p.weights = nil
+	p.health = nil
+	p.ejected = 0
+	p.updateFingerprintLocked()
+	return nil
+}
+
+var (
+	_ PeerPicker    = (*GRPCPool)(nil)
+	_ ReplicaPicker = (*GRPCPool)(nil)
+	_ LeasePicker   = (*GRPCPool)(nil)
+)
+
+// grpcServer implements the GroupCache service.
+type grpcServer struct {
+	pb.UnimplementedGroupCacheServer
+	pool *GRPCPool
+}
+
+func (s *grpcServer) Get(ctx context.Context, in *pb.Request) (*pb.Response, error) {
+	if in.GetGroup() == "" {
+		// a health probe, not logged since every peer sends one each interval
+		return nil, statusOf(ctx, errorf(pb.ErrorCode_BAD_REQUEST, "group is required"))
+	}
+	s.pool.logf("gRPC Get %s/%s", in.GetGroup(), in.GetKey())
+	s.checkFingerprint(ctx)
+	group := GetGroup(in.GetGroup())
+	if group == nil {
+		return nil, statusOf(ctx, errorf(pb.ErrorCode_BAD_REQUEST, "no such group: "+in.GetGroup()))
+	}
+	view, err := group.GetContext(ctx, in.GetKey())
+	if err != nil {
+		return nil, statusOf(ctx, err)
+	}
+	return &pb.Response{Value: view.ByteSlice()}, nil
+}
+
+func (s *grpcServer) Lease(ctx context.Context, in *pb.LeaseRequest) (*pb.LeaseResponse, error) {
+	s.checkFingerprint(ctx)
+	group := GetGroup(in.GetGroup())
+	if group == nil {
+		return nil, statusOf(ctx, errorf(pb.ErrorCode_BAD_REQUEST, "no such group: "+in.GetGroup()))
+	}
+	out := &pb.LeaseResponse{}
+	group.grantLease(in, out)
+	return out, nil
+}
+
+// checkFingerprint reports a peer whose ring differs from ours,
+// see HTTPPool.checkFingerprint.
+func (s *grpcServer) checkFingerprint(ctx context.Context) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	theirs := md.Get(ringMetadata)
+	ours := s.pool.Fingerprint()
+	if len(theirs) == 0 || ours == 0 {
+		return
+	}
+	if theirs[0] != strconv.FormatUint(ours, 16) {
+		ringMismatches.Add(1)
+		s.pool.logf("ring mismatch: theirs %s, ours %x", theirs[0], ours)
+	}
+}
+
+// statusOf maps err to the gRPC status of its error code, and sends the
+// code itself in a trailer so that the peer can restore the *Error.
+// If the request itself was cancelled or timed out, there is nobody to
+// answer and the caller sees the failure as a transport error.
+func statusOf(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return status.FromContextError(ctx.Err()).Err()
+	}
+	code := codeOf(err)
+	grpc.SetTrailer(ctx, metadata.Pairs(errorCodeMetadata, code.String()))
+	return status.Error(grpcCode(code), remoteMessage(code, err))
+}
+
+type grpcGetter struct {
+	pool     *GRPCPool
+	addr     string
+	conn     *grpc.ClientConn
+	err      error        // error creating conn
+	inflight atomic.Int64 // requests in flight to this peer
+}
+
+func (g *grpcGetter) Get(in *pb.Request, out *pb.Response) error {
+	return g.invoke(pb.GroupCache_Get_FullMethodName, in, out)
+}
+
+// Lease asks the peer for a lease on in.Key.
+func (g *grpcGetter) Lease(in *pb.LeaseRequest, out *pb.LeaseResponse) error {
+	return g.invoke(pb.GroupCache_Lease_FullMethodName, in, out)
+}
+
+// invoke calls method on the peer within the pool's timeout.
+// An error reported by the peer is returned as an *Error. Transport
+// failures carry their gRPC status, except that the context errors of
+// the call are returned as context.Canceled and context.DeadlineExceeded.
+func (g *grpcGetter) invoke(method string, in, out interface{}) error {
+	err := g.call(method, in, out)
+	g.pool.report(g.addr, transportError(err))
+	return err
+}
+
+// call calls method on the peer.
+func (g *grpcGetter) call(method string, in, out interface{}) error {
+	if g.err != nil {
+		return g.err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), g.pool.timeout)
+	defer cancel()
+	if fp := g.pool.Fingerprint(); fp != 0 {
+		ctx = metadata.AppendToOutgoingContext(ctx, ringMetadata, strconv.FormatUint(fp, 16))
+	}
+	g.inflight.Add(1)
+	defer g.inflight.Add(-1)
+	var trailer metadata.MD
+	err := g.conn.Invoke(ctx, method, in, out, grpc.Trailer(&trailer))
+	if err == nil {
+		return nil
+	}
+	if names := trailer.Get(errorCodeMetadata); len(names) > 0 {
+		code, ok := pb.ErrorCode_value[names[0]]
+		if !ok || code == int32(pb.ErrorCode_OK) {
+			code = int32(pb.ErrorCode_INTERNAL)
+		}
+		return errorf(pb.ErrorCode(code), status.Convert(err).Message())
+	}
+	switch status.Code(err) {
+	case codes.Canceled:
+		return fmt.Errorf("%s: %w", g.addr, context.Canceled)
+	case codes.DeadlineExceeded:
+		return fmt.Errorf("%s: %w", g.addr, context.DeadlineExceeded)
+	}
+	return err
+}
+
+func (g *grpcGetter) inflightRequests() int64 {
+	return g.inflight.Load()
+}
+
+var (
+	_ PeerGetter = (*grpcGetter)(nil)
+	_ Leaser     = (*grpcGetter)(nil)
+)
@@ -0,0 +1,128 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "geecache/geecachepb"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// startGRPC serves pool on a local port and returns its address.
+func startGRPC(t *testing.T, pool *GRPCPool) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	pool.Register(s)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return lis.Addr().String()
+}
+
+func TestGRPCPool(t *testing.T) {
+	release := make(chan struct{})
+	NewGroup("grpc", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if key == "slow" {
+			<-release
+		}
+		if key == "missing" {
+			return nil, fmt.Errorf("missing not exist: %w", ErrNotFound)
+		}
+		if key == "broken" {
+			return nil, errors.New("origin broken")
+		}
+		return []byte("value of " + key), nil
+	}))
+	defer close(release)
+	addr := startGRPC(t, NewGRPCPool("server"))
+
+	client := NewGRPCPoolOpts("client", GRPCPoolOptions{Timeout: 50 * time.Millisecond})
+	defer client.Close()
+	client.Set(addr)
+	peer, ok := client.PickPeer("Tom")
+	if !ok {
+		t.Fatalf("no peer picked for Tom")
+	}
+
+	out := &pb.Response{}
+	if err := peer.Get(&pb.Request{Group: "grpc", Key: "Tom"}, out); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if string(out.GetValue()) != "value of Tom" {
+		t.Fatalf("Get = %q", out.GetValue())
+	}
+
+	err := peer.Get(&pb.Request{Group: "no-such-group", Key: "Tom"}, &pb.Response{})
+	if !errors.Is(err, ErrBadRequest) {
+		t.Fatalf("Get from an unknown group = %v, want ErrBadRequest", err)
+	}
+	err = peer.Get(&pb.Request{Group: "grpc", Key: "missing"}, &pb.Response{})
+	if !errors.Is(err, ErrNotFound) || err.Error() != "missing not exist: not found" {
+		t.Fatalf("Get of a missing key = %v, want ErrNotFound", err)
+	}
+	err = peer.Get(&pb.Request{Group: "grpc", Key: "broken"}, &pb.Response{})
+	if codeOf(err) != pb.ErrorCode_INTERNAL || !isPeerError(err) || err.Error() != "internal error" {
+		t.Fatalf("failed load = %v, want an INTERNAL error of the peer", err)
+	}
+	err = peer.Get(&pb.Request{Group: "grpc", Key: "slow"}, &pb.Response{})
+	if !errors.Is(err, context.DeadlineExceeded) || isPeerError(err) {
+		t.Fatalf("Get from a hung load = %v, want context.DeadlineExceeded", err)
+	}
+
+	// 成员不变时保留连接，节点离开时关闭连接
+	conn := peer.(*grpcGetter).conn
+	client.Set(addr)
+	if again, _ := client.PickPeer("Tom"); again.(*grpcGetter).conn != conn {
+		t.Fatalf("connection not reused after Set with the same peers")
+	}
+	client.Remove(addr)
+	if conn.GetState() != connectivity.Shutdown {
+		t.Fatalf("connection of a removed peer in state %v", conn.GetState())
+	}
+}
+
+func TestGRPCLease(t *testing.T) {
+	NewGroup("grpc-lease", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	addr := startGRPC(t, NewGRPCPool("server"))
+	client := NewGRPCPool("client")
+	defer client.Close()
+	client.Set(addr)
+	peer, _ := client.Peer(addr)
+
+	lease := func(holder string) *pb.LeaseResponse {
+		out := &pb.LeaseResponse{}
+		in := &pb.LeaseRequest{Group: "grpc-lease", Key: "key", Holder: holder, TtlMs: 1000}
+		if err := peer.(Leaser).Lease(in, out); err != nil {
+			t.Fatalf("Lease: %v", err)
+		}
+		return out
+	}
+	if res := lease("a"); !res.GetGranted() {
+		t.Fatalf("first lease = %v", res)
+	}
+	if res := lease("b"); res.GetGranted() || res.GetHolder() != "a" {
+		t.Fatalf("second lease = %v, want held by a", res)
+	}
+}
+
+func TestGRPCProbeHealth(t *testing.T) {
+	addr := startGRPC(t, NewGRPCPool("server"))
+	pool := NewGRPCPoolOpts("self", GRPCPoolOptions{Timeout: time.Second})
+	defer pool.Close()
+	pool.Set("self", addr, "127.0.0.1:1")
+	if err := pool.probeHealth(addr); err != nil {
+		t.Fatalf("probe of a serving peer: %v", err)
+	}
+	if err := pool.probeHealth("127.0.0.1:1"); err == nil {
+		t.Fatalf("probe of an unreachable peer succeeded")
+	}
+}
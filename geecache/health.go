@@ -0,0 +1,218 @@
+package geecache
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxFailures = 3
+	defaultMinBackoff  = time.Second
+	defaultMaxBackoff  = time.Minute
+)
+
+// HealthCheckOptions configure how a pool detects dead peers.
+// A peer that fails MaxFailures requests or probes in a row is ejected,
+// i.e. temporarily removed from the ring, so that its keys move to the
+// other peers instead of every request waiting for it to time out.
+// After its backoff, the peer is re-admitted on probation: if the next
+// request or probe fails, it is ejected again for twice as long.
+type HealthCheckOptions struct {
+	// Interval is the time between active probes of every peer.
+	// If zero, peers are not probed, and ejected peers are re-admitted
+	// as soon as their backoff expires.
+	// If positive, ejected peers are re-admitted once a probe succeeds.
+	Interval time.Duration
+
+	// MaxFailures is the number of consecutive failures that ejects a peer.
+	// Only transport failures count, not errors reported by the peer.
+	// If zero, defaultMaxFailures is used. If negative, peers are never
+	// ejected.
+	MaxFailures int
+
+	// MinBackoff and MaxBackoff bound the time a peer stays ejected.
+	// If zero, defaultMinBackoff and defaultMaxBackoff are used.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// withDefaults returns o with zero fields set to their defaults.
+func (o HealthCheckOptions) withDefaults() HealthCheckOptions {
+	if o.MaxFailures == 0 {
+		o.MaxFailures = defaultMaxFailures
+	}
+	if o.MinBackoff == 0 {
+		o.MinBackoff = defaultMinBackoff
+	}
+	if o.MaxBackoff == 0 {
+		o.MaxBackoff = defaultMaxBackoff
+	}
+	if o.MaxBackoff < o.MinBackoff {
+		o.MaxBackoff = o.MinBackoff
+	}
+	return o
+}
+
+// peerHealth is the health of a peer in a peerRing.
+type peerHealth struct {
+	failures  int           // consecutive failures
+	ejected   bool          // removed from the placement
+	until     time.Time     // end of the ejection
+	backoff   time.Duration // length of the next ejection
+	probation bool          // re-admitted, ejected again on the next failure
+}
+
+// transportError returns err unless it is nil or was reported by the peer:
+// a peer that answers with an error is alive, so only transport failures
+// count against its health.
+func transportError(err error) error {
+	if err == nil || isPeerError(err) {
+		return nil
+	}
+	return err
+}
+
+// report records the result of a request or probe to peer.
+// A nil err is a success.
+func (p *peerRing) report(peer string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		// the pool was closed while the request was in flight
+		return
+	}
+	h, ok := p.health[peer]
+	if !ok || peer == p.self || p.healthOpts.MaxFailures < 0 {
+		return
+	}
+	now := time.Now()
+	if err == nil {
+		if h.ejected {
+			// only probes reach ejected peers
+			p.readmitLocked(peer, h)
+		}
+		h.failures = 0
+		h.probation = false
+		h.backoff = p.healthOpts.MinBackoff
+		return
+	}
+
+	h.failures++
+	switch {
+	case h.ejected:
+		if !now.Before(h.until) {
+			// a probe after the backoff failed, wait longer
+			p.extendLocked(h, now)
+		}
+	case h.probation || h.failures >= p.healthOpts.MaxFailures:
+		p.ejectLocked(peer, h, now)
+	}
+}
+
+// ejectLocked removes peer from the placement for its backoff.
+func (p *peerRing) ejectLocked(peer string, h *peerHealth, now time.Time) {
+	p.peers.Remove(peer)
+	h.ejected = true
+	p.ejected++
+	p.extendLocked(h, now)
+	p.updateFingerprintLocked()
+	p.logf("ejected peer %s for %v after %d failures", peer, h.until.Sub(now), h.failures)
+}
+
+// extendLocked starts the next ejection period and doubles the backoff.
+func (p *peerRing) extendLocked(h *peerHealth, now time.Time) {
+	h.until = now.Add(h.backoff)
+	h.backoff *= 2
+	if h.backoff > p.healthOpts.MaxBackoff {
+		h.backoff = p.healthOpts.MaxBackoff
+	}
+}
+
+// readmitLocked adds an ejected peer back to the placement on probation.
+func (p *peerRing) readmitLocked(peer string, h *peerHealth) {
+	p.insertLocked(map[string]int{peer: p.weights[peer]})
+	h.ejected = false
+	p.ejected--
+	h.probation = true
+	h.failures = 0
+	p.updateFingerprintLocked()
+	p.logf("re-admitted peer %s", peer)
+}
+
+// readmitExpiredLocked re-admits the ejected peers whose backoff expired,
+// unless probes decide when to re-admit them.
+func (p *peerRing) readmitExpiredLocked() {
+	if p.ejected == 0 || p.probe != nil {
+		return
+	}
+	now := time.Now()
+	for peer, h := range p.health {
+		if h.ejected && !now.Before(h.until) {
+			p.readmitLocked(peer, h)
+		}
+	}
+}
+
+// startProbes probes every peer each interval until stopProbes is called.
+func (p *peerRing) startProbes(interval time.Duration, probe func(peer string) error) {
+	p.probe = probe
+	p.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				p.probeAll()
+			}
+		}
+	}()
+}
+
+// stopProbes stops the probes started by startProbes, if any.
+func (p *peerRing) stopProbes() {
+	p.stopOnce.Do(func() {
+		if p.stop != nil {
+			close(p.stop)
+		}
+	})
+}
+
+// probeAll probes the peers in the pool concurrently, skipping ejected
+// peers whose backoff has not expired.
+func (p *peerRing) probeAll() {
+	now := time.Now()
+	var peers []string
+	p.mu.Lock()
+	for peer, h := range p.health {
+		if peer != p.self && !(h.ejected && now.Before(h.until)) {
+			peers = append(peers, peer)
+		}
+	}
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, peer := range peers {
+		wg.Add(1)
+		go func(peer string) {
+			defer wg.Done()
+			p.report(peer, p.probe(peer))
+		}(peer)
+	}
+	wg.Wait()
+}
+
+// Ejected returns the peers that are currently ejected from the ring.
+func (p *peerRing) Ejected() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var peers []string
+	for peer, h := range p.health {
+		if h.ejected {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
@@ -0,0 +1,200 @@
+package geecache
+
+import (
+	"errors"
+	pb "geecache/geecachepb"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFor 轮询 cond 直到其为真，超时则失败
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// owns 判断 peer 是否拥有一部分 key
+func owns(p *peerRing, peer string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := 0; i < 100; i++ {
+		if p.pickLocked(string(rune('a'+i))) == peer {
+			return true
+		}
+	}
+	return false
+}
+
+func TestPassiveEjection(t *testing.T) {
+	NewGroup("health", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value of " + key), nil
+	}))
+	live := httptest.NewServer(NewHTTPPool("live"))
+	defer live.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	backoff := 50 * time.Millisecond
+	p := NewHTTPPoolOpts("self", HTTPPoolOptions{
+		HealthCheck: HealthCheckOptions{MaxFailures: 2, MinBackoff: backoff},
+		Timeout:     time.Second,
+	})
+	p.Set("self", live.URL, dead.URL)
+	get := func(peer string) error {
+		g, ok := p.Peer(peer)
+		if !ok {
+			t.Fatalf("peer %s not in the pool", peer)
+		}
+		return g.Get(&pb.Request{Group: "health", Key: "Tom"}, &pb.Response{})
+	}
+
+	// 对端返回的错误说明它还活着，不计入失败
+	for i := 0; i < 3; i++ {
+		g, _ := p.Peer(live.URL)
+		if err := g.Get(&pb.Request{Group: "no such group", Key: "Tom"}, &pb.Response{}); err == nil {
+			t.Fatalf("Get from an unknown group succeeded")
+		}
+	}
+	if len(p.Ejected()) != 0 {
+		t.Fatalf("Ejected = %v after errors reported by the peer", p.Ejected())
+	}
+
+	if err := get(dead.URL); err == nil {
+		t.Fatalf("Get from a dead peer succeeded")
+	}
+	if len(p.Ejected()) != 0 {
+		t.Fatalf("peer ejected after a single failure")
+	}
+	get(dead.URL)
+	if ejected := p.Ejected(); len(ejected) != 1 || ejected[0] != dead.URL {
+		t.Fatalf("Ejected = %v, want [%s]", ejected, dead.URL)
+	}
+	if owns(&p.peerRing, dead.URL) {
+		t.Errorf("ejected peer still owns keys")
+	}
+
+	// 退避结束后重新加入，试用期内失败一次即再次被剔除，且退避加倍
+	time.Sleep(backoff)
+	if !owns(&p.peerRing, dead.URL) {
+		t.Errorf("peer not re-admitted after its backoff")
+	}
+	get(dead.URL)
+	p.mu.Lock()
+	h := p.health[dead.URL]
+	if !h.ejected {
+		t.Fatalf("peer on probation not ejected after a failure")
+	}
+	if d := time.Until(h.until); d <= backoff {
+		t.Errorf("second ejection lasts %v, want more than %v", d, backoff)
+	}
+	p.mu.Unlock()
+
+	// 成功后恢复正常：重新失败 MaxFailures 次才会被剔除
+	time.Sleep(2 * backoff)
+	if err := get(live.URL); err != nil {
+		t.Fatalf("Get from a live peer: %v", err)
+	}
+	p.report(dead.URL, nil)
+	if len(p.Ejected()) != 0 {
+		t.Fatalf("Ejected = %v after a success", p.Ejected())
+	}
+	get(dead.URL)
+	if len(p.Ejected()) != 0 {
+		t.Fatalf("peer ejected after a single failure once healthy")
+	}
+}
+
+func TestHealthProbes(t *testing.T) {
+	var down atomic.Bool
+	server := NewHTTPPoolOpts("server", HTTPPoolOptions{Secrets: [][]byte{[]byte("secret")}})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		server.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	// 健康检查不需要签名
+	res, err := http.Get(srv.URL + defaultBasePath + healthPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("health check returned %v", res.Status)
+	}
+
+	p := NewHTTPPoolOpts("self", HTTPPoolOptions{
+		Secrets: [][]byte{[]byte("secret")},
+		HealthCheck: HealthCheckOptions{
+			Interval:    5 * time.Millisecond,
+			MaxFailures: 1,
+			MinBackoff:  10 * time.Millisecond,
+		},
+	})
+	defer p.Close()
+	p.Set("self", srv.URL)
+
+	down.Store(true)
+	waitFor(t, "the peer to be ejected", func() bool { return len(p.Ejected()) == 1 })
+	down.Store(false)
+	waitFor(t, "the peer to be re-admitted", func() bool { return len(p.Ejected()) == 0 })
+	if !owns(&p.peerRing, srv.URL) {
+		t.Fatalf("re-admitted peer owns no keys")
+	}
+}
+
+func TestReportAfterClose(t *testing.T) {
+	p := NewGRPCPool("self")
+	p.Set("self", "127.0.0.1:1")
+	p.Close()
+	// 关闭连接使进行中的请求失败，失败在关闭之后才上报
+	for i := 0; i < defaultMaxFailures+1; i++ {
+		p.report("127.0.0.1:1", errors.New("connection closed"))
+	}
+	p.report("127.0.0.1:1", nil)
+	if ejected := p.Ejected(); len(ejected) != 0 {
+		t.Fatalf("Ejected = %v after Close", ejected)
+	}
+	if _, ok := p.PickPeer("Tom"); ok {
+		t.Fatalf("peer picked after Close")
+	}
+}
+
+func TestSetKeepsEjectedPeers(t *testing.T) {
+	p := NewHTTPPoolOpts("self", HTTPPoolOptions{
+		HealthCheck: HealthCheckOptions{MaxFailures: 1, MinBackoff: time.Hour},
+	})
+	p.Set("self", "http://a", "http://b")
+	p.report("http://b", errors.New("unreachable"))
+	if ejected := p.Ejected(); len(ejected) != 1 {
+		t.Fatalf("Ejected = %v, want [http://b]", ejected)
+	}
+
+	// 服务发现以相同的列表刷新时，被剔除的节点仍留在环外
+	p.Set("self", "http://a", "http://b")
+	if ejected := p.Ejected(); len(ejected) != 1 || ejected[0] != "http://b" {
+		t.Fatalf("Ejected = %v after Set with the same peers, want [http://b]", ejected)
+	}
+	if owns(&p.peerRing, "http://b") {
+		t.Fatalf("ejected peer owns keys after Set with the same peers")
+	}
+
+	// 离开又重新加入的节点重新开始
+	p.Set("self", "http://a")
+	p.Set("self", "http://a", "http://b")
+	if ejected := p.Ejected(); len(ejected) != 0 || !owns(&p.peerRing, "http://b") {
+		t.Fatalf("peer that rejoined is still ejected: %v", ejected)
+	}
+}
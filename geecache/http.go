@@ -1,15 +1,19 @@
 package geecache
 
 import (
+	"bytes"
+	"crypto/tls"
+	"expvar"
 	"fmt"
 	"geecache/consistenthash"
 	pb "geecache/geecachepb"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
-	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 )
@@ -17,29 +21,153 @@ import (
 const (
 	defaultBasePath = "/_geecache/"
 	defaultReplicas = 50
+	defaultTimeout  = 5 * time.Second
+	// ringHeader carries the sender's ring fingerprint in hex.
+	ringHeader = "X-Geecache-Ring"
+	// leasePath is where peers POST lease requests, relative to basePath.
+	// It shadows a group of the same name.
+	leasePath = "_lease"
+	// healthPath answers GET with 200 OK while the peer is serving,
+	// relative to basePath. It shadows a group of the same name.
+	healthPath = "_health"
 )
 
+// ringMismatches counts requests from peers whose ring fingerprint differs
+// from ours, i.e. peers that disagree with us on who owns which key.
+var ringMismatches = expvar.NewInt("geecache_ring_mismatches")
+
 // HTTPPool implements PeerPicker for a pool of HTTP peers.
+// Peers are named by their base URL, e.g. "https://example.net:8000".
 type HTTPPool struct {
-	// this peer's base URL, e.g. "https://example.net:8000"
-	self        string
-	basePath    string
-	mu          sync.Mutex // guards peers and httpGetters
-	peers       *consistenthash.Map
-	httpGetters map[string]*httpGetter // keyed by e.g. "http://10.0.0.2:8008"
+	peerRing
+	basePath  string
+	client    *http.Client // used for requests to other peers
+	tlsConfig *tls.Config  // used to serve https:// peers, may be nil
+	signer    *signer      // nil if requests are not signed
+}
+
+// HTTPPoolOptions are the configurations of an HTTPPool.
+type HTTPPoolOptions struct {
+	// BasePath is the path the pool is mounted under, e.g. "/cache/".
+	// Every peer must use the same base path.
+	// If empty, "/_geecache/" is used.
+	BasePath string
+
+	// Replicas is the number of virtual nodes per peer on the default ring.
+	// If zero, defaultReplicas is used. Ignored if Placement is set.
+	Replicas int
+
+	// Placement returns an empty placement that decides which peer owns
+	// a key, e.g. consistenthash.NewMaglev(0, nil).
+	// If nil, a consistent hash ring with defaultReplicas is used.
+	// Every peer must use the same placement.
+	Placement func() consistenthash.Placement
+
+	// HashFn is the hash function of the default ring, e.g.
+	// consistenthash.XXHash64, or consistenthash.NewSipHash with a secret
+	// shared by the cluster so that clients cannot predict key owners.
+	// If nil, consistenthash.CRC32 is used. Ignored if Placement is set.
+	HashFn consistenthash.Hash
+
+	// LoadBound enables consistent hashing with bounded loads if positive.
+	// A peer with more than (1+LoadBound) times the average number of
+	// in-flight requests is skipped in favor of the next peer for the key.
+	// It only applies to placements implementing
+	// consistenthash.BoundedPlacement, such as the default ring.
+	LoadBound float64
+
+	// Transport makes the requests to other peers.
+	// If nil, http.DefaultTransport is used, with TLSConfig if set.
+	Transport http.RoundTripper
+
+	// TLSConfig is used both to connect to https:// peers and to serve
+	// them in ListenAndServe, e.g. MutualTLSConfig for peers that verify
+	// each other's certificates against a shared CA.
+	// If Transport is set, it must be configured for TLS itself.
+	TLSConfig *tls.Config
+
+	// Timeout limits the time of a request to another peer, including
+	// reading the response body, so that a hung peer cannot block
+	// loads forever. If zero, defaultTimeout is used.
+	Timeout time.Duration
+
+	// Secrets enables signed requests between peers. Requests to other
+	// peers are signed with HMAC-SHA256 using the first secret, and
+	// requests without a valid signature of any of the secrets, or
+	// replayed ones, are rejected. To rotate, give every peer the new
+	// secret second, then first, then drop the old one.
+	// Every peer must share the secrets.
+	Secrets [][]byte
+
+	// HealthCheck configures the ejection of peers that keep failing.
+	// If HealthCheck.Interval is positive, every peer's health endpoint
+	// is probed that often until Close is called.
+	HealthCheck HealthCheckOptions
 }
 
 // NewHTTPPool initializes an HTTP pool of peers.
 func NewHTTPPool(self string) *HTTPPool {
-	return &HTTPPool{
-		self:     self,
-		basePath: defaultBasePath,
+	return NewHTTPPoolOpts(self, HTTPPoolOptions{})
+}
+
+// NewHTTPPoolOpts initializes an HTTP pool of peers with the given options.
+func NewHTTPPoolOpts(self string, o HTTPPoolOptions) *HTTPPool {
+	p := &HTTPPool{
+		peerRing: peerRing{
+			self:         self,
+			newPlacement: newPlacementFunc(o.Placement, o.Replicas, o.HashFn),
+			loadBound:    o.LoadBound,
+			healthOpts:   o.HealthCheck.withDefaults(),
+		},
+		basePath:  o.BasePath,
+		client:    &http.Client{Transport: newTransport(o.Transport, o.TLSConfig), Timeout: o.Timeout},
+		tlsConfig: o.TLSConfig,
+		signer:    newSigner(o.Secrets),
+	}
+	p.newGetter = func(peer string) poolGetter {
+		return &httpGetter{pool: p, peer: peer, baseURL: peer + p.basePath}
+	}
+	if p.basePath == "" {
+		p.basePath = defaultBasePath
+	}
+	if !strings.HasPrefix(p.basePath, "/") {
+		p.basePath = "/" + p.basePath
+	}
+	if !strings.HasSuffix(p.basePath, "/") {
+		p.basePath += "/"
+	}
+	if p.client.Timeout == 0 {
+		p.client.Timeout = defaultTimeout
+	}
+	if o.HealthCheck.Interval > 0 {
+		p.startProbes(o.HealthCheck.Interval, p.probeHealth)
+	}
+	return p
+}
+
+// Close stops the health probes of the pool, if any.
+func (p *HTTPPool) Close() error {
+	p.stopProbes()
+	return nil
+}
+
+// probeHealth checks the health endpoint of peer.
+func (p *HTTPPool) probeHealth(peer string) error {
+	res, err := p.client.Get(peer + p.basePath + healthPath)
+	if err != nil {
+		return err
 	}
+	defer res.Body.Close()
+	ioutil.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check returned: %v", res.Status)
+	}
+	return nil
 }
 
 // Log info with server name
 func (p *HTTPPool) Log(format string, v ...interface{}) {
-	log.Printf("[Server %s] %s", p.self, fmt.Sprintf(format, v...))
+	p.logf(format, v...)
 }
 
 // ServeHTTP handle all http requests
@@ -47,11 +175,30 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if !strings.HasPrefix(r.URL.Path, p.basePath) {
 		panic("HTTPPool serving unexpected path: " + r.URL.Path)
 	}
+	// health checks are neither logged nor signed: they are frequent,
+	// and reveal nothing but that the peer is up
+	if r.URL.Path == p.basePath+healthPath {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("ok\n"))
+		return
+	}
 	p.Log("%s %s", r.Method, r.URL.Path)
+	if p.signer != nil {
+		if err := p.signer.verify(r); err != nil {
+			p.Log("rejected request from %s: %v", r.RemoteAddr, err)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	p.checkFingerprint(r)
+	if r.URL.Path == p.basePath+leasePath {
+		p.serveLease(w, r)
+		return
+	}
 	// /<basepath>/<groupname>/<key> required
 	parts := strings.SplitN(r.URL.Path[len(p.basePath):], "/", 2)
 	if len(parts) != 2 {
-		http.Error(w, "bad request", http.StatusBadRequest)
+		writeError(w, errorf(pb.ErrorCode_BAD_REQUEST, "bad request"))
 		return
 	}
 
@@ -60,20 +207,20 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	group := GetGroup(groupName)
 	if group == nil {
-		http.Error(w, "no such group: "+groupName, http.StatusNotFound)
+		writeError(w, errorf(pb.ErrorCode_BAD_REQUEST, "no such group: "+groupName))
 		return
 	}
 
-	view, err := group.Get(key)
+	view, err := group.GetContext(r.Context(), key)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
 	// Write the value to the response body as a proto message.
 	body, err := proto.Marshal(&pb.Response{Value: view.ByteSlice()})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
@@ -81,33 +228,80 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Write(body)
 }
 
-// Set updates the pool's list of peers.
-func (p *HTTPPool) Set(peers ...string) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	p.peers = consistenthash.New(defaultReplicas, nil)
-	p.peers.Add(peers...)
-	p.httpGetters = make(map[string]*httpGetter, len(peers))
-	for _, peer := range peers {
-		p.httpGetters[peer] = &httpGetter{baseURL: peer + p.basePath}
+// serveLease answers a lease request of another peer.
+func (p *HTTPPool) serveLease(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, errorf(pb.ErrorCode_BAD_REQUEST, "method not allowed"))
+		return
 	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, errorf(pb.ErrorCode_BAD_REQUEST, err.Error()))
+		return
+	}
+	in := &pb.LeaseRequest{}
+	if err := proto.Unmarshal(body, in); err != nil {
+		writeError(w, errorf(pb.ErrorCode_BAD_REQUEST, "bad request"))
+		return
+	}
+	group := GetGroup(in.GetGroup())
+	if group == nil {
+		writeError(w, errorf(pb.ErrorCode_BAD_REQUEST, "no such group: "+in.GetGroup()))
+		return
+	}
+
+	out := &pb.LeaseResponse{}
+	group.grantLease(in, out)
+	body, err = proto.Marshal(out)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(body)
+}
+
+// writeError writes err as a Response carrying its error code, with the
+// HTTP status of the code, so that the peer can tell the errors apart.
+func writeError(w http.ResponseWriter, err error) {
+	code := codeOf(err)
+	message := remoteMessage(code, err)
+	body, merr := proto.Marshal(&pb.Response{ErrorCode: code, Error: message})
+	if merr != nil {
+		http.Error(w, message, httpStatus(code))
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(httpStatus(code))
+	w.Write(body)
 }
 
-// PickPeer picks a peer according to key
-func (p *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	if peer := p.peers.Get(key); peer != "" && peer != p.self {
-		p.Log("Pick peer %s", peer)
-		return p.httpGetters[peer], true
+// checkFingerprint reports a peer whose ring differs from ours.
+// Such peers forward keys we don't consider ours, which leads to
+// requests bouncing between peers or keys loaded twice.
+func (p *HTTPPool) checkFingerprint(r *http.Request) {
+	theirs := r.Header.Get(ringHeader)
+	ours := p.fingerprint.Load()
+	if theirs == "" || ours == 0 {
+		return
+	}
+	if theirs != strconv.FormatUint(ours, 16) {
+		ringMismatches.Add(1)
+		p.Log("ring mismatch with %s: theirs %s, ours %x", r.RemoteAddr, theirs, ours)
 	}
-	return nil, false
 }
 
-var _ PeerPicker = (*HTTPPool)(nil)
+var (
+	_ PeerPicker    = (*HTTPPool)(nil)
+	_ ReplicaPicker = (*HTTPPool)(nil)
+	_ LeasePicker   = (*HTTPPool)(nil)
+)
 
 type httpGetter struct {
-	baseURL string
+	pool     *HTTPPool
+	peer     string // name of the peer in the pool
+	baseURL  string
+	inflight atomic.Int64 // requests in flight to this peer
 }
 
 func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
@@ -117,26 +311,80 @@ func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
 		url.QueryEscape(in.GetGroup()),
 		url.QueryEscape(in.GetKey()),
 	)
-	res, err := http.Get(u)
+	req, err := http.NewRequest(http.MethodGet, u, nil)
 	if err != nil {
 		return err
 	}
-	defer res.Body.Close()
+	return h.roundTrip(req, out)
+}
 
-	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned: %v", res.Status)
+// Lease asks the peer for a lease on in.Key.
+func (h *httpGetter) Lease(in *pb.LeaseRequest, out *pb.LeaseResponse) error {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, h.baseURL+leasePath, bytes.NewReader(body))
+	if err != nil {
+		return err
 	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	return h.roundTrip(req, out)
+}
 
-	bytes, err := ioutil.ReadAll(res.Body)
+// roundTrip sends req to the peer and decodes the response body into out.
+// An error reported by the peer is returned as an *Error. Any other error,
+// e.g. a refused connection or an error page of a proxy in between,
+// is a transport failure.
+func (h *httpGetter) roundTrip(req *http.Request, out proto.Message) error {
+	err := h.send(req, out)
+	h.pool.report(h.peer, transportError(err))
+	return err
+}
+
+// send sends req to the peer and decodes the response into out.
+func (h *httpGetter) send(req *http.Request, out proto.Message) error {
+	if fp := h.pool.Fingerprint(); fp != 0 {
+		req.Header.Set(ringHeader, strconv.FormatUint(fp, 16))
+	}
+	if h.pool.signer != nil {
+		if err := h.pool.signer.sign(req); err != nil {
+			return err
+		}
+	}
+	h.inflight.Add(1)
+	defer h.inflight.Add(-1)
+	res, err := h.pool.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
 	if err != nil {
 		return fmt.Errorf("reading response body: %v", err)
 	}
 
-	if err = proto.Unmarshal(bytes, out); err != nil {
+	if res.StatusCode != http.StatusOK {
+		perr := &pb.Response{}
+		if proto.Unmarshal(body, perr) == nil && perr.GetErrorCode() != pb.ErrorCode_OK {
+			return errorf(perr.GetErrorCode(), perr.GetError())
+		}
+		return fmt.Errorf("server returned: %v", res.Status)
+	}
+
+	if err = proto.Unmarshal(body, out); err != nil {
 		return fmt.Errorf("decoding response body: %v", err)
 	}
 
 	return nil
 }
 
-var _ PeerGetter = (*httpGetter)(nil)
+func (h *httpGetter) inflightRequests() int64 {
+	return h.inflight.Load()
+}
+
+var (
+	_ PeerGetter = (*httpGetter)(nil)
+	_ Leaser     = (*httpGetter)(nil)
+)
@@ -0,0 +1,146 @@
+package geecache
+
+import (
+	"geecache/consistenthash"
+	pb "geecache/geecachepb"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRingFingerprint(t *testing.T) {
+	a := NewHTTPPool("http://a")
+	a.Set("http://a", "http://b")
+	b := NewHTTPPool("http://b")
+	b.Set("http://b", "http://a")
+	if a.Fingerprint() == 0 || a.Fingerprint() != b.Fingerprint() {
+		t.Fatalf("peers with the same members have fingerprints %x and %x", a.Fingerprint(), b.Fingerprint())
+	}
+
+	serve := func(fp uint64) {
+		req := httptest.NewRequest(http.MethodGet, defaultBasePath+"no-such-group/key", nil)
+		req.Header.Set(ringHeader, strconv.FormatUint(fp, 16))
+		b.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	before := ringMismatches.Value()
+	serve(a.Fingerprint())
+	if ringMismatches.Value() != before {
+		t.Fatalf("matching fingerprint counted as a mismatch")
+	}
+
+	a.Add("http://c")
+	serve(a.Fingerprint())
+	if ringMismatches.Value() != before+1 {
+		t.Fatalf("mismatching fingerprint not counted")
+	}
+}
+
+func TestHTTPPoolOptions(t *testing.T) {
+	NewGroup("http-options", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value of " + key), nil
+	}))
+	pool := NewHTTPPoolOpts("self", HTTPPoolOptions{BasePath: "cache", Replicas: 3})
+	if pool.basePath != "/cache/" {
+		t.Fatalf("base path = %q, want /cache/", pool.basePath)
+	}
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+
+	peer := &httpGetter{pool: pool, baseURL: srv.URL + pool.basePath}
+	out := &pb.Response{}
+	if err := peer.Get(&pb.Request{Group: "http-options", Key: "Tom"}, out); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if string(out.GetValue()) != "value of Tom" {
+		t.Fatalf("Get = %q", out.GetValue())
+	}
+}
+
+func TestHTTPPoolTimeout(t *testing.T) {
+	release := make(chan struct{})
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer hung.Close()
+	defer close(release)
+
+	pool := NewHTTPPoolOpts("self", HTTPPoolOptions{Timeout: 20 * time.Millisecond})
+	peer := &httpGetter{pool: pool, baseURL: hung.URL + pool.basePath}
+	done := make(chan error, 1)
+	go func() {
+		done <- peer.Get(&pb.Request{Group: "g", Key: "k"}, &pb.Response{})
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatalf("Get from a hung peer succeeded")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Get from a hung peer did not time out")
+	}
+}
+
+func TestHTTPPoolWeights(t *testing.T) {
+	pool := NewHTTPPoolOpts("http://self", HTTPPoolOptions{Replicas: 200, HashFn: consistenthash.XXHash64})
+	pool.SetWeighted(Peer{URL: "http://small", Weight: 1}, Peer{URL: "http://large", Weight: 4})
+	counts := make(map[string]int)
+	pool.mu.Lock()
+	for i := 0; i < 10000; i++ {
+		counts[pool.pickLocked(strconv.Itoa(i))]++
+	}
+	pool.mu.Unlock()
+	// 权重为 4 的节点应分到约 4 倍的 key
+	if ratio := float64(counts["http://large"]) / float64(counts["http://small"]); ratio < 3 || ratio > 5 {
+		t.Fatalf("keys per peer = %v, want a ratio of about 4", counts)
+	}
+}
+
+func TestHTTPPoolLoadBound(t *testing.T) {
+	pool := NewHTTPPoolOpts("http://self", HTTPPoolOptions{LoadBound: 0.25})
+	pool.Set("http://a", "http://b", "http://c")
+	owner, ok := pool.PickPeer("Tom")
+	if !ok {
+		t.Fatalf("no peer picked for Tom")
+	}
+
+	// 负责的节点请求过多时，key 溢出到环上的下一个节点
+	owner.(*httpGetter).inflight.Add(10)
+	if g, ok := pool.PickPeer("Tom"); !ok || g == owner {
+		t.Fatalf("overloaded peer %s still picked", owner.(*httpGetter).peer)
+	}
+	owner.(*httpGetter).inflight.Add(-10)
+	if g, _ := pool.PickPeer("Tom"); g != owner {
+		t.Fatalf("peer not picked again once its load dropped")
+	}
+}
+
+func TestHTTPPoolPickPeers(t *testing.T) {
+	pool := NewHTTPPool("http://b")
+	pool.Set("http://a", "http://b", "http://c")
+	for _, key := range []string{"Tom", "Jack", "Sam"} {
+		peers := pool.PickPeers(key, 3)
+		pool.mu.Lock()
+		want := pool.peers.GetN(key, 3)
+		pool.mu.Unlock()
+		if len(peers) != len(want) {
+			t.Fatalf("PickPeers(%q) returned %d peers, want %d", key, len(peers), len(want))
+		}
+		// 顺序与环上的顺序一致，本节点的位置为 nil
+		for i, peer := range want {
+			if peer == pool.Self() {
+				if peers[i] != nil {
+					t.Fatalf("PickPeers(%q)[%d] = %v, want nil for self", key, i, peers[i])
+				}
+				continue
+			}
+			if g, ok := peers[i].(*httpGetter); !ok || g.peer != peer {
+				t.Fatalf("PickPeers(%q)[%d] = %v, want %s", key, i, peers[i], peer)
+			}
+		}
+	}
+	if peers := pool.PickPeers("Tom", 5); len(peers) != 3 {
+		t.Fatalf("PickPeers with n above the pool size returned %d peers, want 3", len(peers))
+	}
+}
@@ -0,0 +1,151 @@
+package geecache
+
+import (
+	pb "geecache/geecachepb"
+	"log"
+	"sync"
+	"time"
+)
+
+// DefaultLeaseTTL 是 EnableLeases 未指定时长时租约的有效期
+const DefaultLeaseTTL = time.Second
+
+// leaseManagers 是依次尝试申请租约的节点数，
+// 拥有者不可达时由 key 的下一个副本节点管理租约
+const leaseManagers = 2
+
+// lease 表示某个节点获得了从数据源加载某个 key 的权利
+type lease struct {
+	holder  string
+	expires time.Time
+}
+
+// leaseTable 记录本节点作为管理者发放的租约
+type leaseTable struct {
+	mu      sync.Mutex
+	m       map[string]lease
+	sweepAt int // 记录数达到 sweepAt 时清理过期的租约
+}
+
+// acquire 为 holder 申请 key 的租约。
+// 没有有效租约或租约本就属于 holder 时发放新的租约，
+// 否则返回当前的持有者及租约的剩余时长。
+func (t *leaseTable) acquire(key, holder string, ttl time.Duration) (granted bool, current string, remaining time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	if l, ok := t.m[key]; ok && l.holder != holder && now.Before(l.expires) {
+		return false, l.holder, l.expires.Sub(now)
+	}
+	if t.m == nil {
+		t.m = make(map[string]lease)
+	}
+	if len(t.m) >= t.sweepAt {
+		t.sweepLocked(now)
+	}
+	t.m[key] = lease{holder: holder, expires: now.Add(ttl)}
+	return true, holder, ttl
+}
+
+// sweepLocked 删除所有过期的租约，避免不再被访问的 key 一直占用内存
+func (t *leaseTable) sweepLocked(now time.Time) {
+	for key, l := range t.m {
+		if !now.Before(l.expires) {
+			delete(t.m, key)
+		}
+	}
+	t.sweepAt = 2 * len(t.m)
+	if t.sweepAt < 64 {
+		t.sweepAt = 64
+	}
+}
+
+// EnableLeases 开启集群范围的加载去重。
+// 开启后，节点在从数据源加载 key 之前先向 key 的拥有者申请租约，
+// 拥有者不可达时依次向之后的副本节点申请。
+// 没有拿到租约的节点不访问数据源，而是向持有租约的节点获取数据，
+// 持有者正在加载时，该请求会加入持有者进行中的加载并等待其结果。
+// ttl 是租约的有效期，不大于 0 时使用 DefaultLeaseTTL，
+// 加载时间超过 ttl 时其他节点可能重新获得租约。
+// 需要 PeerPicker 实现 LeasePicker，节点的 PeerGetter 实现 Leaser。
+func (g *Group) EnableLeases(ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = DefaultLeaseTTL
+	}
+	g.leaseTTL = ttl
+}
+
+// grantLease 处理其他节点发来的租约申请。
+// 申请的有效期不能超过本节点的租约有效期，避免某个节点长时间锁住一个 key
+func (g *Group) grantLease(in *pb.LeaseRequest, out *pb.LeaseResponse) {
+	maxTTL := g.leaseTTL
+	if maxTTL <= 0 {
+		maxTTL = DefaultLeaseTTL
+	}
+	ttl := time.Duration(in.GetTtlMs()) * time.Millisecond
+	if ttl <= 0 || ttl > maxTTL {
+		ttl = maxTTL
+	}
+	granted, holder, remaining := g.leases.acquire(in.GetKey(), in.GetHolder(), ttl)
+	out.Granted = granted
+	out.Holder = holder
+	out.TtlMs = remaining.Milliseconds()
+}
+
+// leaseHolder 为本节点申请 key 的租约，返回持有租约的其他节点。
+// 本节点获得租约，或无法从任何管理者处得到结果时返回 nil，此时应在本地加载。
+// unreachable 是刚刚无法联系的节点，不再向它申请租约，以免再等待一次超时。
+func (g *Group) leaseHolder(key string, unreachable PeerGetter) PeerGetter {
+	lp, ok := g.peers.(LeasePicker)
+	if !ok {
+		return nil
+	}
+	self := lp.Self()
+	for _, manager := range g.leaseManagersOf(key) {
+		var holder string
+		if manager == nil {
+			// 本节点就是管理者
+			granted, current, _ := g.leases.acquire(key, self, g.leaseTTL)
+			if granted {
+				return nil
+			}
+			holder = current
+		} else {
+			leaser, ok := manager.(Leaser)
+			if !ok || manager == unreachable {
+				continue
+			}
+			req := &pb.LeaseRequest{
+				Group:  g.name,
+				Key:    key,
+				Holder: self,
+				TtlMs:  g.leaseTTL.Milliseconds(),
+			}
+			res := &pb.LeaseResponse{}
+			if err := leaser.Lease(req, res); err != nil {
+				log.Println("[GeeCache] Failed to get lease", err)
+				continue
+			}
+			if res.GetGranted() {
+				return nil
+			}
+			holder = res.GetHolder()
+		}
+		if peer, ok := lp.Peer(holder); ok {
+			return peer
+		}
+		return nil
+	}
+	return nil
+}
+
+// leaseManagersOf 返回依次申请 key 的租约的节点，nil 表示本节点
+func (g *Group) leaseManagersOf(key string) []PeerGetter {
+	if rp, ok := g.peers.(ReplicaPicker); ok {
+		return rp.PickPeers(key, leaseManagers)
+	}
+	if peer, ok := g.peers.PickPeer(key); ok {
+		return []PeerGetter{peer}
+	}
+	return []PeerGetter{nil}
+}
@@ -0,0 +1,178 @@
+package geecache
+
+import (
+	"errors"
+	pb "geecache/geecachepb"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLeaseTable(t *testing.T) {
+	var leases leaseTable
+	if granted, _, _ := leases.acquire("key", "a", 20*time.Millisecond); !granted {
+		t.Fatalf("first lease not granted")
+	}
+	if granted, holder, remaining := leases.acquire("key", "b", time.Second); granted || holder != "a" || remaining <= 0 {
+		t.Fatalf("lease held by a granted to b: %v, %q, %v", granted, holder, remaining)
+	}
+	if granted, _, _ := leases.acquire("key", "a", 20*time.Millisecond); !granted {
+		t.Fatalf("lease not renewed for its holder")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if granted, _, _ := leases.acquire("key", "b", time.Second); !granted {
+		t.Fatalf("expired lease not granted to another peer")
+	}
+}
+
+// leasePeer 是测试用的节点，Get 返回 value 或 err，Lease 由 lease 决定
+type leasePeer struct {
+	value []byte
+	err   error
+	lease func(in *pb.LeaseRequest, out *pb.LeaseResponse) error
+}
+
+func (p *leasePeer) Get(in *pb.Request, out *pb.Response) error {
+	if p.err != nil {
+		return p.err
+	}
+	out.Value = p.value
+	return nil
+}
+
+func (p *leasePeer) Lease(in *pb.LeaseRequest, out *pb.LeaseResponse) error {
+	return p.lease(in, out)
+}
+
+// leasePicker 将所有 key 交给 owner，replicas 为 PickPeers 的结果
+type leasePicker struct {
+	owner    PeerGetter
+	replicas []PeerGetter
+	peers    map[string]PeerGetter
+}
+
+func (p *leasePicker) PickPeer(key string) (PeerGetter, bool)   { return p.owner, true }
+func (p *leasePicker) PickPeers(key string, n int) []PeerGetter { return p.replicas }
+func (p *leasePicker) Self() string                             { return "self" }
+func (p *leasePicker) Peer(name string) (PeerGetter, bool) {
+	peer, ok := p.peers[name]
+	return peer, ok
+}
+
+func newLeaseGroup(name string, picker *leasePicker) (*Group, *int) {
+	loads := 0
+	g := NewGroup(name, 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte("origin"), nil
+	}))
+	g.RegisterPeers(picker)
+	g.EnableLeases(time.Second)
+	return g, &loads
+}
+
+// unreachablePeer 返回一个 Get 失败的节点，向它申请租约会使测试失败
+func unreachablePeer(t *testing.T) *leasePeer {
+	return &leasePeer{err: errors.New("unreachable"), lease: func(in *pb.LeaseRequest, out *pb.LeaseResponse) error {
+		t.Errorf("lease requested from a peer that just failed")
+		return errors.New("unreachable")
+	}}
+}
+
+func TestLeaseFetchFromHolder(t *testing.T) {
+	owner := unreachablePeer(t)
+	// 拥有者刚刚不可达，直接向下一个副本申请租约
+	manager := &leasePeer{lease: func(in *pb.LeaseRequest, out *pb.LeaseResponse) error {
+		if in.GetHolder() != "self" || in.GetKey() != "key" {
+			t.Errorf("unexpected lease request %v", in)
+		}
+		out.Holder = "holder"
+		return nil
+	}}
+	picker := &leasePicker{
+		owner:    owner,
+		replicas: []PeerGetter{owner, manager},
+		peers:    map[string]PeerGetter{"holder": &leasePeer{value: []byte("from holder")}},
+	}
+	g, loads := newLeaseGroup("lease-holder", picker)
+
+	v, err := g.Get("key")
+	if err != nil || v.String() != "from holder" {
+		t.Fatalf("Get = %q, %v, want the value of the lease holder", v, err)
+	}
+	if *loads != 0 {
+		t.Fatalf("origin loaded %d times without a lease", *loads)
+	}
+}
+
+func TestLeaseGranted(t *testing.T) {
+	owner := unreachablePeer(t)
+	manager := &leasePeer{lease: func(in *pb.LeaseRequest, out *pb.LeaseResponse) error {
+		out.Granted = true
+		out.Holder = in.GetHolder()
+		return nil
+	}}
+	picker := &leasePicker{owner: owner, replicas: []PeerGetter{owner, manager}}
+	g, loads := newLeaseGroup("lease-granted", picker)
+
+	if v, err := g.Get("key"); err != nil || v.String() != "origin" {
+		t.Fatalf("Get = %q, %v", v, err)
+	}
+	if *loads != 1 {
+		t.Fatalf("origin loaded %d times, want 1", *loads)
+	}
+}
+
+func TestLeaseOwnerUnreachable(t *testing.T) {
+	owner := unreachablePeer(t)
+	// 拥有者不可达时，下一个副本（本节点）管理租约
+	picker := &leasePicker{owner: owner, replicas: []PeerGetter{owner, nil}}
+	g, loads := newLeaseGroup("lease-unreachable", picker)
+
+	if v, err := g.Get("key"); err != nil || v.String() != "origin" || *loads != 1 {
+		t.Fatalf("Get = %q, %v after %d loads", v, err, *loads)
+	}
+	out := &pb.LeaseResponse{}
+	g.grantLease(&pb.LeaseRequest{Key: "key", Holder: "other"}, out)
+	if out.GetGranted() || out.GetHolder() != "self" {
+		t.Fatalf("lease held by this peer granted to another: %v", out)
+	}
+}
+
+func TestGrantLeaseTTLCapped(t *testing.T) {
+	g, _ := newLeaseGroup("lease-ttl", &leasePicker{})
+	out := &pb.LeaseResponse{}
+	g.grantLease(&pb.LeaseRequest{Key: "key", Holder: "other", TtlMs: time.Hour.Milliseconds()}, out)
+	if !out.GetGranted() || out.GetTtlMs() != time.Second.Milliseconds() {
+		t.Fatalf("lease = %v, want granted for the local lease TTL of 1s", out)
+	}
+}
+
+func TestServeLease(t *testing.T) {
+	NewGroup("lease-http", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	pool := NewHTTPPool("self")
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+	peer := &httpGetter{pool: pool, baseURL: srv.URL + defaultBasePath}
+
+	lease := func(holder string) *pb.LeaseResponse {
+		out := &pb.LeaseResponse{}
+		in := &pb.LeaseRequest{Group: "lease-http", Key: "key", Holder: holder, TtlMs: 1000}
+		if err := peer.Lease(in, out); err != nil {
+			t.Fatalf("Lease: %v", err)
+		}
+		return out
+	}
+	if res := lease("a"); !res.GetGranted() || res.GetTtlMs() != 1000 {
+		t.Fatalf("first lease = %v", res)
+	}
+	if res := lease("b"); res.GetGranted() || res.GetHolder() != "a" {
+		t.Fatalf("second lease = %v, want held by a", res)
+	}
+
+	err := peer.Lease(&pb.LeaseRequest{Group: "no-such-group", Key: "key"}, &pb.LeaseResponse{})
+	if err == nil {
+		t.Fatalf("lease in an unknown group succeeded")
+	}
+}
@@ -2,22 +2,47 @@ package lfu
 
 import (
 	"container/list"
-	"fmt"
 )
 
+// DefaultEntryOverhead 是每条记录在 key 与 value 之外大致占用的内存字节数，
+// 包括链表节点、entry 结构体、哈希表槽位以及频率桶的分摊开销。
+const DefaultEntryOverhead = 144
+
+// Cache 是一个 LFU 缓存，所有操作的时间复杂度均为 O(1)（Age 与 RemoveExpired 除外）。
+// 相同使用频率的记录放在同一个频率桶中，频率桶按频率从低到高串成链表，
+// 因此最低频率的桶始终位于链表头部，无需单独维护 minFreq。
 type Cache struct {
-	maxBytes   int64
-	nbytes     int64
-	minFreq    int
-	cache      map[string]*list.Element // 哈希表
-	freqToList map[int]*list.List       // 使用频率
-	OnEvicted  func(key string, value Value)
+	maxBytes      int64
+	maxEntries    int   // 最大记录数，0 表示不限制
+	entryOverhead int64 // 每条记录额外计入 nbytes 的字节数
+	agingPeriod   int   // 每访问 agingPeriod 次将所有频率减半，0 表示不衰减
+	accesses      int   // 距上一次衰减的访问次数
+	nbytes        int64
+	buckets       *list.List               // 频率桶链表，Front 为最低频率
+	cache         map[string]*list.Element // 哈希表，值为记录在频率桶中的节点
+	OnEvicted     func(key string, value Value)
+}
+
+// Options 是创建 Cache 时的配置
+type Options struct {
+	MaxBytes      int64 // 最大字节数，0 表示不限制
+	MaxEntries    int   // 最大记录数，0 表示不限制
+	EntryOverhead int64 // 每条记录额外计入的字节数，可使用 DefaultEntryOverhead
+	AgingPeriod   int   // 每访问 AgingPeriod 次将所有频率减半，0 表示不衰减
+	OnEvicted     func(key string, value Value)
+}
+
+// bucket 保存使用频率相同的记录，桶内 Front 为最近访问的记录
+type bucket struct {
+	freq    int
+	entries *list.List
 }
 
 type entry struct {
-	key   string
-	value Value
-	freq  int
+	key        string
+	value      Value
+	expiration int64         // 过期时间的 Unix() 时间戳，0 表示永不过期
+	bucket     *list.Element // 所属的频率桶
 }
 
 type Value interface {
@@ -25,105 +50,199 @@ type Value interface {
 }
 
 func New(maxBytes int64, onEvicted func(key string, value Value)) *Cache {
+	return NewWithOptions(Options{MaxBytes: maxBytes, OnEvicted: onEvicted})
+}
+
+// NewWithOptions 按 opts 创建一个 Cache 实例
+func NewWithOptions(opts Options) *Cache {
 	return &Cache{
-		maxBytes:   maxBytes,
-		freqToList: make(map[int]*list.List),
-		cache:      make(map[string]*list.Element),
-		OnEvicted:  onEvicted,
+		maxBytes:      opts.MaxBytes,
+		maxEntries:    opts.MaxEntries,
+		entryOverhead: opts.EntryOverhead,
+		agingPeriod:   opts.AgingPeriod,
+		buckets:       list.New(),
+		cache:         make(map[string]*list.Element),
+		OnEvicted:     opts.OnEvicted,
 	}
 }
 
-func (c *Cache) PushFront(e *entry) {
-	if _, ok := c.freqToList[e.freq]; !ok {
-		c.freqToList[e.freq] = list.New() // 双向链表
+// size 返回一条记录计入 nbytes 的字节数
+func (c *Cache) size(key string, value Value) int64 {
+	return int64(len(key)) + int64(value.Len()) + c.entryOverhead
+}
+
+// overflow 判断再加入 pending 条记录后是否超过字节数或记录数限制，
+// 这些记录的字节数已计入 nbytes
+func (c *Cache) overflow(pending int) bool {
+	return (c.maxBytes != 0 && c.maxBytes < c.nbytes) ||
+		(c.maxEntries != 0 && c.maxEntries < len(c.cache)+pending)
+}
+
+// evict 淘汰使用频率最低的记录，直到加入 pending 条记录后不超过限制
+func (c *Cache) evict(pending int) {
+	for len(c.cache) > 0 && c.overflow(pending) {
+		c.RemoveOldest()
+	}
+}
+
+// bucketAfter 返回紧跟在 at 之后、频率为 freq 的桶，不存在时创建。
+// at 为 nil 表示从链表头部开始。
+func (c *Cache) bucketAfter(at *list.Element, freq int) *list.Element {
+	next := c.buckets.Front()
+	if at != nil {
+		next = at.Next()
+	}
+	if next != nil && next.Value.(*bucket).freq == freq {
+		return next
+	}
+	b := &bucket{freq: freq, entries: list.New()}
+	if at == nil {
+		return c.buckets.PushFront(b)
 	}
-	c.cache[e.key] = c.freqToList[e.freq].PushFront(e)
+	return c.buckets.InsertAfter(b, at)
 }
 
-// 删除
+// moveTo 将记录移动到频率桶 to 的头部，原来的桶为空时将其删除
+func (c *Cache) moveTo(ele *list.Element, to *list.Element) {
+	kv := ele.Value.(*entry)
+	from := kv.bucket
+	from.Value.(*bucket).entries.Remove(ele)
+	kv.bucket = to
+	c.cache[kv.key] = to.Value.(*bucket).entries.PushFront(kv)
+	if from.Value.(*bucket).entries.Len() == 0 {
+		c.buckets.Remove(from)
+	}
+}
+
+// increment 将记录的使用频率加一
+func (c *Cache) increment(ele *list.Element) {
+	cur := ele.Value.(*entry).bucket
+	c.moveTo(ele, c.bucketAfter(cur, cur.Value.(*bucket).freq+1))
+}
+
+// removeElement 从频率桶和哈希表中删除记录
+func (c *Cache) removeElement(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	b := kv.bucket.Value.(*bucket)
+	b.entries.Remove(ele)
+	if b.entries.Len() == 0 {
+		c.buckets.Remove(kv.bucket)
+	}
+	delete(c.cache, kv.key)
+	c.nbytes -= c.size(kv.key, kv.value)
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+// 删除使用频率最低的记录，频率相同时删除最久未访问的记录
 func (c *Cache) RemoveOldest() {
-	if lst, ok := c.freqToList[c.minFreq]; ok {
-		ele := lst.Back()
-		if ele != nil {
-			lst.Remove(ele)
-			kv := ele.Value.(*entry)
-			delete(c.cache, kv.key)
-			c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
-			if c.OnEvicted != nil {
-				c.OnEvicted(kv.key, kv.value)
-			}
-		}
-		if lst.Len() == 0 {
-			delete(c.freqToList, c.minFreq)
-		}
-	} else {
-		c.minFreq++
-		c.RemoveOldest()
+	if front := c.buckets.Front(); front != nil {
+		c.removeElement(front.Value.(*bucket).entries.Back())
 	}
 }
 
-func (c *Cache) GetEntry(key string) (e *entry, ok bool) {
+func (c *Cache) RemoveKey(key string) {
 	if ele, ok := c.cache[key]; ok {
-		kv := ele.Value.(*entry)
-		lst := c.freqToList[kv.freq]
-		lst.Remove(ele)
-		if lst.Len() == 0 {
-			delete(c.freqToList, kv.freq)
-			if c.minFreq == kv.freq {
-				c.minFreq++
+		c.removeElement(ele)
+	}
+}
+
+// RemoveExpired 按使用频率从低到高删除在 now 时刻已过期的记录，返回删除的数量。
+// 同一频率内先删除最久未访问的记录。
+func (c *Cache) RemoveExpired(now int64) int {
+	removed := 0
+	for be := c.buckets.Front(); be != nil; {
+		// 桶中的记录全部删除后桶也会被删除，需要提前保存下一个桶
+		next := be.Next()
+		entries := be.Value.(*bucket).entries
+		for ele := entries.Back(); ele != nil; {
+			prev := ele.Prev()
+			if kv := ele.Value.(*entry); kv.expiration != 0 && now > kv.expiration {
+				c.removeElement(ele)
+				removed++
 			}
+			ele = prev
 		}
-
-		kv.freq++
-		c.PushFront(kv)
-		return kv, true
+		be = next
 	}
-	return
+	return removed
 }
 
 // 查找
-func (c *Cache) Get(key string) (value Value, ok bool) {
-	if kv, ok := c.GetEntry(key); ok {
-		return kv.value, true
+func (c *Cache) Get(key string) (value Value, expiration int64, ok bool) {
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		c.increment(ele)
+		c.tick()
+		return kv.value, kv.expiration, true
 	}
 	return
 }
 
-// 新增/修改
-func (c *Cache) Add(key string, value Value) {
-	if kv, ok := c.GetEntry(key); ok {
+// tick 记录一次访问，达到衰减周期时将所有频率减半
+func (c *Cache) tick() {
+	if c.agingPeriod == 0 {
+		return
+	}
+	c.accesses++
+	if c.accesses >= c.agingPeriod {
+		c.Age()
+	}
+}
 
-		c.nbytes += int64(value.Len()) - int64(kv.value.Len())
-		fmt.Println(value, int64(value.Len()))
-		fmt.Println(kv.value, int64(kv.value.Len()))
-		for c.maxBytes != 0 && c.maxBytes < c.nbytes {
-			c.RemoveOldest()
+// Age 将所有记录的使用频率减半（最小为 1），
+// 使曾经的热点数据可以被淘汰，缓存得以适应访问热度的变化。
+func (c *Cache) Age() {
+	c.accesses = 0
+	old := c.buckets
+	c.buckets = list.New()
+	// 按频率从低到高重新插入，合并后的桶中原频率较低的记录排在尾部，先被淘汰
+	for be := old.Front(); be != nil; be = be.Next() {
+		b := be.Value.(*bucket)
+		freq := b.freq / 2
+		if freq < 1 {
+			freq = 1
 		}
-
-		kv.value = value
-		return
-	} else {
-		// 新增
-		c.nbytes += int64(len(key)) + int64(value.Len())
-		for c.maxBytes != 0 && c.maxBytes < c.nbytes {
-			c.RemoveOldest()
+		to := c.buckets.Back()
+		if to == nil || to.Value.(*bucket).freq != freq {
+			to = c.buckets.PushBack(&bucket{freq: freq, entries: list.New()})
 		}
-
-		if _, ok := c.freqToList[1]; !ok {
-			c.freqToList[1] = list.New()
+		for ele := b.entries.Back(); ele != nil; ele = ele.Prev() {
+			kv := ele.Value.(*entry)
+			kv.bucket = to
+			c.cache[kv.key] = to.Value.(*bucket).entries.PushFront(kv)
 		}
-		lst := c.freqToList[1]
-		ele := lst.PushFront(&entry{key, value, 1})
-		c.cache[key] = ele
-		c.minFreq = 1
-
-	}
-	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
-		c.RemoveOldest()
 	}
+}
 
+// 新增/修改
+func (c *Cache) Add(key string, value Value, expiration int64) {
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		c.nbytes += int64(value.Len()) - int64(kv.value.Len())
+		kv.value = value
+		kv.expiration = expiration
+		c.increment(ele)
+	} else {
+		// 新增，先淘汰再插入：新记录位于最低频率桶，
+		// 若先插入，其余记录频率都更高时淘汰的会是新记录本身
+		c.nbytes += c.size(key, value)
+		c.evict(1)
+		kv := &entry{key: key, value: value, expiration: expiration}
+		kv.bucket = c.bucketAfter(nil, 1)
+		c.cache[key] = kv.bucket.Value.(*bucket).entries.PushFront(kv)
+	}
+	// 新记录本身超过限制时也会被淘汰
+	c.evict(0)
+	c.tick()
 }
 
 func (c *Cache) Len() int {
 	return len(c.cache)
 }
+
+// Bytes 返回当前计入的字节数
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
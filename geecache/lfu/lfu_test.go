@@ -0,0 +1,139 @@
+package lfu
+
+import (
+	"geecache/cachetest"
+	"reflect"
+	"testing"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+// policy 将 Cache 适配为 cachetest.Policy
+type policy struct {
+	*Cache
+}
+
+func (p policy) Add(key string, value cachetest.Value, expiration int64) {
+	p.Cache.Add(key, value, expiration)
+}
+
+func (p policy) Get(key string) (cachetest.Value, int64, bool) {
+	return p.Cache.Get(key)
+}
+
+func TestConformance(t *testing.T) {
+	cachetest.Run(t, func(maxBytes int64, maxEntries int, onEvicted func(string, cachetest.Value)) cachetest.Policy {
+		opts := Options{MaxBytes: maxBytes, MaxEntries: maxEntries}
+		if onEvicted != nil {
+			opts.OnEvicted = func(key string, value Value) { onEvicted(key, value) }
+		}
+		return policy{NewWithOptions(opts)}
+	})
+}
+
+func TestExpiration(t *testing.T) {
+	lfu := New(0, nil)
+	lfu.Add("k1", String("v1"), 10)
+	if v, exp, ok := lfu.Get("k1"); !ok || string(v.(String)) != "v1" || exp != 10 {
+		t.Fatalf("Get k1 = %v, %v, %v", v, exp, ok)
+	}
+	lfu.Add("k1", String("v1"), 20)
+	if _, exp, _ := lfu.Get("k1"); exp != 20 {
+		t.Fatalf("expiration not updated, got %d", exp)
+	}
+
+	lfu.RemoveKey("k1")
+	if _, _, ok := lfu.Get("k1"); ok || lfu.Len() != 0 || lfu.nbytes != 0 {
+		t.Fatalf("RemoveKey k1 failed")
+	}
+}
+
+func TestRemoveExpired(t *testing.T) {
+	var evicted []string
+	lfu := New(0, func(key string, value Value) {
+		evicted = append(evicted, key)
+	})
+	lfu.Add("hot", String("v"), 5)
+	lfu.Get("hot")
+	lfu.Add("cold", String("v"), 5)
+	lfu.Add("forever", String("v"), 0)
+	lfu.Add("fresh", String("v"), 100)
+
+	if n := lfu.RemoveExpired(50); n != 2 {
+		t.Fatalf("RemoveExpired removed %d entries, want 2", n)
+	}
+	if expect := []string{"cold", "hot"}; !reflect.DeepEqual(evicted, expect) {
+		t.Fatalf("evicted %v, want %v", evicted, expect)
+	}
+	if lfu.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", lfu.Len())
+	}
+}
+
+func TestAging(t *testing.T) {
+	lfu := NewWithOptions(Options{MaxEntries: 2})
+	lfu.Add("old", String("v"), 0)
+	for i := 0; i < 8; i++ {
+		lfu.Get("old")
+	}
+	lfu.Add("k1", String("v"), 0)
+	lfu.Get("k1")
+	lfu.Get("k1")
+
+	for i := 0; i < 3; i++ {
+		lfu.Age()
+	}
+	// old 的频率从 9 衰减到 1，k1 再访问一次后频率为 2，新增 k2 时淘汰 old
+	lfu.Get("k1")
+	lfu.Add("k2", String("v"), 0)
+	if _, _, ok := lfu.Get("old"); ok {
+		t.Fatalf("aged entry should have been evicted")
+	}
+	if _, _, ok := lfu.Get("k1"); !ok {
+		t.Fatalf("k1 should still be cached")
+	}
+}
+
+func TestAgingPeriod(t *testing.T) {
+	lfu := NewWithOptions(Options{AgingPeriod: 4})
+	lfu.Add("k1", String("v"), 0)
+	lfu.Get("k1")
+	lfu.Get("k1")
+	lfu.Get("k1") // 第 4 次访问，频率 4 减半为 2
+	if freq := lfu.cache["k1"].Value.(*entry).bucket.Value.(*bucket).freq; freq != 2 {
+		t.Fatalf("freq = %d, want 2", freq)
+	}
+}
+
+func TestRemoveOldest(t *testing.T) {
+	var evicted []string
+	lfu := New(0, func(key string, value Value) {
+		evicted = append(evicted, key)
+	})
+	lfu.Add("k1", String("v"), 0)
+	lfu.Add("k2", String("v"), 0)
+	lfu.Get("k2")
+	lfu.Add("k3", String("v"), 0)
+	for i := 0; i < 3; i++ {
+		lfu.Get("k3")
+	}
+	lfu.Add("k4", String("v"), 0)
+	lfu.Get("k4")
+
+	// 删除最低频率的 k1 后，最低频率的桶变为 2，其中 k2 最久未访问
+	lfu.RemoveKey("k1")
+	lfu.RemoveOldest()
+	lfu.RemoveOldest()
+	lfu.RemoveOldest()
+	if expect := []string{"k1", "k2", "k4", "k3"}; !reflect.DeepEqual(evicted, expect) {
+		t.Fatalf("evicted %v, want %v", evicted, expect)
+	}
+	lfu.RemoveOldest()
+	if lfu.Len() != 0 || lfu.buckets.Len() != 0 {
+		t.Fatalf("Len() = %d, buckets = %d on empty cache", lfu.Len(), lfu.buckets.Len())
+	}
+}
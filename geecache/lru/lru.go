@@ -4,12 +4,26 @@ import (
 	"container/list"
 )
 
+// DefaultEntryOverhead 是每条记录在 key 与 value 之外大致占用的内存字节数，
+// 包括链表节点、entry 结构体以及哈希表槽位。
+const DefaultEntryOverhead = 128
+
 type Cache struct {
-	maxBytes  int64
-	nbytes    int64
-	ll        *list.List               // 双向链表
-	cache     map[string]*list.Element // 哈希表
-	OnEvicted func(key string, value Value)
+	maxBytes      int64
+	maxEntries    int   // 最大记录数，0 表示不限制
+	entryOverhead int64 // 每条记录额外计入 nbytes 的字节数
+	nbytes        int64
+	ll            *list.List               // 双向链表
+	cache         map[string]*list.Element // 哈希表
+	OnEvicted     func(key string, value Value)
+}
+
+// Options 是创建 Cache 时的配置
+type Options struct {
+	MaxBytes      int64 // 最大字节数，0 表示不限制
+	MaxEntries    int   // 最大记录数，0 表示不限制
+	EntryOverhead int64 // 每条记录额外计入的字节数，可使用 DefaultEntryOverhead
+	OnEvicted     func(key string, value Value)
 }
 
 type entry struct {
@@ -23,11 +37,36 @@ type Value interface {
 }
 
 func New(maxBytes int64, onEvicted func(key string, value Value)) *Cache {
+	return NewWithOptions(Options{MaxBytes: maxBytes, OnEvicted: onEvicted})
+}
+
+// NewWithOptions 按 opts 创建一个 Cache 实例
+func NewWithOptions(opts Options) *Cache {
 	return &Cache{
-		maxBytes:  maxBytes,
-		ll:        list.New(),
-		cache:     make(map[string]*list.Element),
-		OnEvicted: onEvicted,
+		maxBytes:      opts.MaxBytes,
+		maxEntries:    opts.MaxEntries,
+		entryOverhead: opts.EntryOverhead,
+		ll:            list.New(),
+		cache:         make(map[string]*list.Element),
+		OnEvicted:     opts.OnEvicted,
+	}
+}
+
+// size 返回一条记录计入 nbytes 的字节数
+func (c *Cache) size(key string, value Value) int64 {
+	return int64(len(key)) + int64(value.Len()) + c.entryOverhead
+}
+
+// overflow 判断当前是否超过字节数或记录数限制
+func (c *Cache) overflow() bool {
+	return (c.maxBytes != 0 && c.maxBytes < c.nbytes) ||
+		(c.maxEntries != 0 && c.maxEntries < c.ll.Len())
+}
+
+// evict 淘汰最久未使用的记录直到不超过限制
+func (c *Cache) evict() {
+	for c.ll.Len() > 0 && c.overflow() {
+		c.RemoveOldest()
 	}
 }
 
@@ -49,7 +88,7 @@ func (c *Cache) RemoveOldest() {
 		c.ll.Remove(ele)
 		kv := ele.Value.(*entry)
 		delete(c.cache, kv.key)
-		c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
+		c.nbytes -= c.size(kv.key, kv.value)
 		if c.OnEvicted != nil {
 			c.OnEvicted(kv.key, kv.value)
 		}
@@ -61,7 +100,7 @@ func (c *Cache) RemoveKey(key string) {
 		c.ll.Remove(ele)
 		kv := ele.Value.(*entry)
 		delete(c.cache, key)
-		c.nbytes -= int64(len(key)) + int64(kv.value.Len())
+		c.nbytes -= c.size(key, kv.value)
 		if c.OnEvicted != nil {
 			c.OnEvicted(key, kv.value)
 		}
@@ -75,23 +114,75 @@ func (c *Cache) Add(key string, value Value, expiration int64) {
 		kv := ele.Value.(*entry)
 
 		c.nbytes += int64(value.Len()) - int64(kv.value.Len())
-		for c.maxBytes != 0 && c.maxBytes < c.nbytes {
-			c.RemoveOldest()
-		}
-
 		kv.value = value
 		kv.expiration = expiration
 	} else {
-		c.nbytes += int64(len(key)) + int64(value.Len())
-		for c.maxBytes != 0 && c.maxBytes < c.nbytes {
-			c.RemoveOldest()
-		}
-
+		c.nbytes += c.size(key, value)
 		ele := c.ll.PushFront(&entry{key, value, expiration})
 		c.cache[key] = ele
 	}
+	c.evict()
 }
 
 func (c *Cache) Len() int {
 	return c.ll.Len()
 }
+
+// Peek 查找键对应的值，但不改变其在链表中的位置
+func (c *Cache) Peek(key string) (value Value, expiration int64, ok bool) {
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		return kv.value, kv.expiration, true
+	}
+	return
+}
+
+// Contains 判断键是否存在，不改变其在链表中的位置
+func (c *Cache) Contains(key string) bool {
+	_, ok := c.cache[key]
+	return ok
+}
+
+// Keys 按从新到旧的顺序返回所有键
+func (c *Cache) Keys() []string {
+	keys := make([]string, 0, c.ll.Len())
+	for ele := c.ll.Front(); ele != nil; ele = ele.Next() {
+		keys = append(keys, ele.Value.(*entry).key)
+	}
+	return keys
+}
+
+// Range 按从新到旧的顺序遍历所有记录，fn 返回 false 时停止遍历。
+// 遍历不会改变记录的位置，fn 中不能修改缓存。
+func (c *Cache) Range(fn func(key string, value Value, expiration int64) bool) {
+	for ele := c.ll.Front(); ele != nil; ele = ele.Next() {
+		kv := ele.Value.(*entry)
+		if !fn(kv.key, kv.value, kv.expiration) {
+			return
+		}
+	}
+}
+
+// Resize 修改最大容量，并淘汰记录直到不超过新的容量
+func (c *Cache) Resize(maxBytes int64) {
+	c.maxBytes = maxBytes
+	c.evict()
+}
+
+// Purge 清空所有记录，每条记录都会触发 OnEvicted
+func (c *Cache) Purge() {
+	if c.OnEvicted != nil {
+		for ele := c.ll.Back(); ele != nil; ele = ele.Prev() {
+			kv := ele.Value.(*entry)
+			c.OnEvicted(kv.key, kv.value)
+		}
+	}
+	c.ll.Init()
+	c.cache = make(map[string]*list.Element)
+	c.nbytes = 0
+}
+
+// Bytes 返回当前计入的字节数
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
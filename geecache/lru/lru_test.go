@@ -0,0 +1,123 @@
+package lru
+
+import (
+	"geecache/cachetest"
+	"reflect"
+	"testing"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+// policy 将 Cache 适配为 cachetest.Policy
+type policy struct {
+	*Cache
+}
+
+func (p policy) Add(key string, value cachetest.Value, expiration int64) {
+	p.Cache.Add(key, value, expiration)
+}
+
+func (p policy) Get(key string) (cachetest.Value, int64, bool) {
+	return p.Cache.Get(key)
+}
+
+func TestConformance(t *testing.T) {
+	cachetest.Run(t, func(maxBytes int64, maxEntries int, onEvicted func(string, cachetest.Value)) cachetest.Policy {
+		opts := Options{MaxBytes: maxBytes, MaxEntries: maxEntries}
+		if onEvicted != nil {
+			opts.OnEvicted = func(key string, value Value) { onEvicted(key, value) }
+		}
+		return policy{NewWithOptions(opts)}
+	})
+}
+
+func TestKeysAndRange(t *testing.T) {
+	lru := New(0, nil)
+	lru.Add("k1", String("v1"), 1)
+	lru.Add("k2", String("v2"), 2)
+	lru.Add("k3", String("v3"), 3)
+	lru.Get("k1")
+
+	expect := []string{"k1", "k3", "k2"}
+	if keys := lru.Keys(); !reflect.DeepEqual(keys, expect) {
+		t.Fatalf("Keys() = %v, want %v", keys, expect)
+	}
+
+	var visited []string
+	lru.Range(func(key string, value Value, expiration int64) bool {
+		visited = append(visited, key)
+		return len(visited) < 2
+	})
+	if !reflect.DeepEqual(visited, expect[:2]) {
+		t.Fatalf("Range visited %v, want %v", visited, expect[:2])
+	}
+}
+
+func TestPeekAndContains(t *testing.T) {
+	lru := New(int64(len("k1v1k2v2")), nil)
+	lru.Add("k1", String("v1"), 1)
+	lru.Add("k2", String("v2"), 2)
+
+	if v, exp, ok := lru.Peek("k1"); !ok || string(v.(String)) != "v1" || exp != 1 {
+		t.Fatalf("Peek k1 = %v, %v, %v", v, exp, ok)
+	}
+	// Peek 不提升 k1，因此新增 k3 时 k1 会被淘汰
+	lru.Add("k3", String("v3"), 3)
+	if lru.Contains("k1") || !lru.Contains("k2") || !lru.Contains("k3") {
+		t.Fatalf("unexpected keys after eviction: %v", lru.Keys())
+	}
+}
+
+func TestResizeAndPurge(t *testing.T) {
+	evicted := make([]string, 0)
+	lru := New(0, func(key string, value Value) {
+		evicted = append(evicted, key)
+	})
+	lru.Add("k1", String("v1"), 1)
+	lru.Add("k2", String("v2"), 2)
+	lru.Add("k3", String("v3"), 3)
+
+	lru.Resize(int64(len("k3v3")))
+	if lru.Len() != 1 || !lru.Contains("k3") {
+		t.Fatalf("Resize left keys %v", lru.Keys())
+	}
+
+	lru.Purge()
+	if lru.Len() != 0 || lru.nbytes != 0 {
+		t.Fatalf("Purge left len %d, nbytes %d", lru.Len(), lru.nbytes)
+	}
+	expect := []string{"k1", "k2", "k3"}
+	if !reflect.DeepEqual(evicted, expect) {
+		t.Fatalf("evicted %v, want %v", evicted, expect)
+	}
+}
+
+func TestMaxEntriesAndOverhead(t *testing.T) {
+	lru := NewWithOptions(Options{MaxEntries: 2})
+	lru.Add("k1", String("v1"), 1)
+	lru.Add("k2", String("v2"), 2)
+	lru.Add("k3", String("v3"), 3)
+	if lru.Len() != 2 || lru.Contains("k1") {
+		t.Fatalf("MaxEntries left keys %v", lru.Keys())
+	}
+
+	lru = NewWithOptions(Options{MaxBytes: 2 * (4 + DefaultEntryOverhead), EntryOverhead: DefaultEntryOverhead})
+	lru.Add("k1", String("v1"), 1)
+	lru.Add("k2", String("v2"), 2)
+	if lru.nbytes != 2*(4+DefaultEntryOverhead) {
+		t.Fatalf("nbytes = %d, want %d", lru.nbytes, 2*(4+DefaultEntryOverhead))
+	}
+	lru.Add("k3", String("v3"), 3)
+	if lru.Len() != 2 || lru.Contains("k1") {
+		t.Fatalf("EntryOverhead left keys %v", lru.Keys())
+	}
+	lru.RemoveKey("k2")
+	lru.RemoveKey("k3")
+	if lru.nbytes != 0 {
+		t.Fatalf("nbytes = %d after removing all keys", lru.nbytes)
+	}
+}
@@ -12,3 +12,29 @@ type PeerPicker interface {
 type PeerGetter interface {
 	Get(in *pb.Request, out *pb.Response) error
 }
+
+// ReplicaPicker is an optional interface a PeerPicker can implement to
+// return every peer responsible for a key in preference order, as needed
+// for replication, hedged reads and failover.
+type ReplicaPicker interface {
+	// PickPeers returns up to n distinct peers for key, starting with the
+	// owner. The entry of the local peer is nil, so callers can tell where
+	// a local load fits in the order.
+	PickPeers(key string, n int) []PeerGetter
+}
+
+// Leaser is an optional interface a PeerGetter can implement to hand out
+// leases for loading keys from the origin, see Group.EnableLeases.
+type Leaser interface {
+	Lease(in *pb.LeaseRequest, out *pb.LeaseResponse) error
+}
+
+// LeasePicker is an optional interface a PeerPicker implements so that
+// its groups can take part in the lease protocol.
+type LeasePicker interface {
+	// Self returns the name of the local peer, as recorded in leases.
+	Self() string
+	// Peer returns the getter of the named peer. ok is false for the
+	// local peer and for peers not in the pool.
+	Peer(name string) (peer PeerGetter, ok bool)
+}
@@ -0,0 +1,309 @@
+package geecache
+
+import (
+	"fmt"
+	"geecache/consistenthash"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Peer describes a peer and its share of the key space.
+type Peer struct {
+	// URL is the peer's base URL, e.g. "http://10.0.0.2:8008",
+	// or its address, e.g. "10.0.0.2:8008", in a GRPCPool.
+	URL string
+	// Weight scales the number of virtual nodes the peer gets on the ring,
+	// e.g. 8 for a 64 GB machine next to 8 GB machines of weight 1.
+	// Zero is treated as 1.
+	Weight int
+}
+
+// peersOf wraps plain peer URLs as peers of weight 1.
+func peersOf(urls []string) []Peer {
+	peers := make([]Peer, len(urls))
+	for i, u := range urls {
+		peers[i] = Peer{URL: u, Weight: 1}
+	}
+	return peers
+}
+
+// poolGetter is the PeerGetter of a peer in a peerRing.
+type poolGetter interface {
+	PeerGetter
+	// inflightRequests returns the number of requests in flight to the peer.
+	inflightRequests() int64
+}
+
+// peerRing keeps the membership of a pool of peers and decides which peer
+// owns a key. It is embedded by HTTPPool and GRPCPool, so both transports
+// place keys the same way.
+type peerRing struct {
+	// this peer's name, e.g. "https://example.net:8000"
+	self string
+	// newPlacement creates an empty placement each time the peers are set.
+	newPlacement func() consistenthash.Placement
+	loadBound    float64
+	// newGetter creates the getter of a peer joining the pool.
+	newGetter func(peer string) poolGetter
+	// closeGetter, if set, releases the getter of a peer leaving the pool.
+	closeGetter func(g poolGetter)
+	mu          sync.Mutex // guards peers, getters, weights, health and ejected
+	peers       consistenthash.Placement
+	getters     map[string]poolGetter // keyed by e.g. "http://10.0.0.2:8008"
+	// weights and health of the peers in the pool, including ejected
+	// peers, which are not in the placement.
+	weights    map[string]int
+	health     map[string]*peerHealth
+	ejected    int // number of ejected peers
+	healthOpts HealthCheckOptions
+	// probe checks the health of a peer, nil if peers are not probed.
+	probe    func(peer string) error
+	stop     chan struct{} // closed to stop the probes
+	stopOnce sync.Once
+	// fingerprint of the placement, zero if it cannot be fingerprinted.
+	// It is cached because computing it walks the whole ring.
+	fingerprint atomic.Uint64
+}
+
+// logf logs info with server name.
+func (p *peerRing) logf(format string, v ...interface{}) {
+	log.Printf("[Server %s] %s", p.self, fmt.Sprintf(format, v...))
+}
+
+// Fingerprint returns the fingerprint of the pool's placement, or zero
+// if the placement does not implement consistenthash.Fingerprinter.
+// Peers with the same fingerprint agree on the owner of every key.
+func (p *peerRing) Fingerprint() uint64 {
+	return p.fingerprint.Load()
+}
+
+// updateFingerprintLocked recomputes the fingerprint after a membership change.
+func (p *peerRing) updateFingerprintLocked() {
+	var fp uint64
+	if f, ok := p.peers.(consistenthash.Fingerprinter); ok {
+		fp = f.Fingerprint()
+	}
+	p.fingerprint.Store(fp)
+}
+
+// Set updates the pool's list of peers.
+func (p *peerRing) Set(peers ...string) {
+	p.SetWeighted(peersOf(peers)...)
+}
+
+// SetWeighted updates the pool's list of peers, giving each peer
+// a share of the key space proportional to its weight.
+func (p *peerRing) SetWeighted(peers ...Peer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	old, oldHealth := p.getters, p.health
+	p.peers = p.newPlacement()
+	p.getters = make(map[string]poolGetter, len(peers))
+	p.weights = make(map[string]int, len(peers))
+	p.health = make(map[string]*peerHealth, len(peers))
+	p.ejected = 0
+	// keep the getters of peers that stay, e.g. their connections, and
+	// their health, so that refreshing the list does not re-admit them
+	for _, peer := range peers {
+		if g, ok := old[peer.URL]; ok {
+			p.getters[peer.URL] = g
+			delete(old, peer.URL)
+		}
+		if h, ok := oldHealth[peer.URL]; ok {
+			if _, dup := p.health[peer.URL]; !dup && h.ejected {
+				p.ejected++
+			}
+			p.health[peer.URL] = h
+		}
+	}
+	p.closeLocked(old)
+	p.addLocked(peers)
+}
+
+// Add adds peers to the pool without rebuilding the ring.
+// Peers that are already in the pool are left untouched.
+func (p *peerRing) Add(peers ...string) {
+	p.AddWeighted(peersOf(peers)...)
+}
+
+// AddWeighted is like Add but for peers with weights.
+func (p *peerRing) AddWeighted(peers ...Peer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		p.peers = p.newPlacement()
+		p.getters = make(map[string]poolGetter, len(peers))
+		p.weights = make(map[string]int, len(peers))
+		p.health = make(map[string]*peerHealth, len(peers))
+	}
+	p.addLocked(peers)
+}
+
+// addLocked adds peers to the pool. Peers that are ejected stay
+// out of the placement until they are re-admitted.
+func (p *peerRing) addLocked(peers []Peer) {
+	insert := make(map[string]int, len(peers))
+	for _, peer := range peers {
+		if _, ok := p.weights[peer.URL]; !ok {
+			p.weights[peer.URL] = peer.Weight
+		}
+		if _, ok := p.health[peer.URL]; !ok {
+			p.health[peer.URL] = &peerHealth{backoff: p.healthOpts.MinBackoff}
+		}
+		if !p.health[peer.URL].ejected {
+			insert[peer.URL] = p.weights[peer.URL]
+		}
+		if _, ok := p.getters[peer.URL]; !ok {
+			p.getters[peer.URL] = p.newGetter(peer.URL)
+		}
+	}
+	p.insertLocked(insert)
+	p.updateFingerprintLocked()
+}
+
+// insertLocked adds peers with their weights to the placement, in one
+// batch if the placement supports it, since e.g. a Maglev placement
+// rebuilds its whole table on every insertion. The weights are ignored
+// if the placement does not support weights.
+func (p *peerRing) insertLocked(weights map[string]int) {
+	if bp, ok := p.peers.(consistenthash.BatchWeightedPlacement); ok {
+		bp.AddAllWeighted(weights)
+		return
+	}
+	peers := make([]string, 0, len(weights))
+	for peer := range weights {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+	if wp, ok := p.peers.(consistenthash.WeightedPlacement); ok {
+		for _, peer := range peers {
+			wp.AddWeighted(peer, weights[peer])
+		}
+		return
+	}
+	p.peers.Add(peers...)
+}
+
+// Remove removes peers from the pool, e.g. a peer that has failed.
+// Keys owned by the remaining peers keep their owners.
+func (p *peerRing) Remove(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return
+	}
+	p.peers.Remove(peers...)
+	removed := make(map[string]poolGetter, len(peers))
+	for _, peer := range peers {
+		if h, ok := p.health[peer]; ok && h.ejected {
+			p.ejected--
+		}
+		delete(p.health, peer)
+		delete(p.weights, peer)
+		if g, ok := p.getters[peer]; ok {
+			removed[peer] = g
+			delete(p.getters, peer)
+		}
+	}
+	p.closeLocked(removed)
+	p.updateFingerprintLocked()
+}
+
+// closeLocked releases the getters of peers that left the pool.
+func (p *peerRing) closeLocked(getters map[string]poolGetter) {
+	if p.closeGetter == nil {
+		return
+	}
+	for _, g := range getters {
+		p.closeGetter(g)
+	}
+}
+
+// PickPeer picks a peer according to key
+func (p *peerRing) PickPeer(key string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil, false
+	}
+	if peer := p.pickLocked(key); peer != "" && peer != p.self {
+		p.logf("Pick peer %s", peer)
+		return p.getters[peer], true
+	}
+	return nil, false
+}
+
+// pickLocked returns the peer that should serve key.
+func (p *peerRing) pickLocked(key string) string {
+	p.readmitExpiredLocked()
+	if p.loadBound > 0 {
+		if bp, ok := p.peers.(consistenthash.BoundedPlacement); ok {
+			return bp.GetBounded(key, p.loadLocked, p.loadBound)
+		}
+	}
+	return p.peers.Get(key)
+}
+
+// loadLocked returns the number of requests in flight to peer.
+// This peer reports no load so that a request forwarded to it because the
+// owner is overloaded is served here instead of bouncing between peers.
+func (p *peerRing) loadLocked(peer string) int64 {
+	if g, ok := p.getters[peer]; ok && peer != p.self {
+		return g.inflightRequests()
+	}
+	return 0
+}
+
+// PickPeers returns up to n peers for key in preference order.
+// The entry of this peer is nil.
+func (p *peerRing) PickPeers(key string, n int) []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil
+	}
+	p.readmitExpiredLocked()
+	nodes := p.peers.GetN(key, n)
+	peers := make([]PeerGetter, len(nodes))
+	for i, node := range nodes {
+		if node != p.self {
+			peers[i] = p.getters[node]
+		}
+	}
+	return peers
+}
+
+// Self returns the name of this peer.
+func (p *peerRing) Self() string {
+	return p.self
+}
+
+// Peer returns the getter of the named peer.
+func (p *peerRing) Peer(name string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if name == p.self {
+		return nil, false
+	}
+	if g, ok := p.getters[name]; ok {
+		return g, true
+	}
+	return nil, false
+}
+
+// newPlacementFunc returns the placement factory for the given options
+// of a pool: placement if set, otherwise a ring of replicas virtual nodes
+// per peer hashed with hashFn.
+func newPlacementFunc(placement func() consistenthash.Placement, replicas int, hashFn consistenthash.Hash) func() consistenthash.Placement {
+	if placement != nil {
+		return placement
+	}
+	if replicas == 0 {
+		replicas = defaultReplicas
+	}
+	return func() consistenthash.Placement {
+		return consistenthash.New(replicas, hashFn)
+	}
+}
@@ -0,0 +1,110 @@
+// Package ringstat 分析哈希环上键的分布情况，并模拟增删节点时键的迁移比例，
+// 用于在变更集群之前评估虚拟节点数与哈希函数的选择。
+package ringstat
+
+import (
+	"geecache/consistenthash"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// NodeStat 是单个节点的统计结果
+type NodeStat struct {
+	Node     string
+	Weight   int
+	KeySpace float64 // 节点在哈希空间中所占的比例
+	Keys     int     // 样本中由该节点负责的键数
+	KeyShare float64 // 样本中由该节点负责的键的比例
+}
+
+// Report 是一个哈希环的分布统计
+type Report struct {
+	Nodes []NodeStat // 按节点名排序
+	// KeySpaceStdDev 是各节点按权重归一化后的哈希空间比例相对于期望值的标准差，
+	// 以期望值的倍数表示，0 表示完全均匀。
+	KeySpaceStdDev float64
+	// KeyShareStdDev 与 KeySpaceStdDev 相同，但基于键样本统计
+	KeyShareStdDev float64
+}
+
+// Analyze 统计哈希环 m 上各节点的哈希空间比例，以及 keys 在各节点上的分布
+func Analyze(m *consistenthash.Map, keys []string) Report {
+	shares := m.Shares()
+	owned := make(map[string]int)
+	for _, key := range keys {
+		owned[m.Get(key)]++
+	}
+
+	var r Report
+	totalWeight := 0
+	for _, node := range m.Nodes() {
+		totalWeight += m.Weight(node)
+	}
+	var spaceDev, keyDev []float64
+	for _, node := range m.Nodes() {
+		s := NodeStat{
+			Node:     node,
+			Weight:   m.Weight(node),
+			KeySpace: shares[node],
+			Keys:     owned[node],
+		}
+		if len(keys) > 0 {
+			s.KeyShare = float64(s.Keys) / float64(len(keys))
+		}
+		expect := float64(s.Weight) / float64(totalWeight)
+		spaceDev = append(spaceDev, s.KeySpace/expect-1)
+		keyDev = append(keyDev, s.KeyShare/expect-1)
+		r.Nodes = append(r.Nodes, s)
+	}
+	r.KeySpaceStdDev = stdDev(spaceDev)
+	if len(keys) > 0 {
+		r.KeyShareStdDev = stdDev(keyDev)
+	}
+	return r
+}
+
+// stdDev 返回偏差的均方根
+func stdDev(devs []float64) float64 {
+	if len(devs) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, d := range devs {
+		sum += d * d
+	}
+	return math.Sqrt(sum / float64(len(devs)))
+}
+
+// Moved 返回 keys 中归属在 before 与 after 之间发生变化的比例
+func Moved(before, after consistenthash.Placement, keys []string) float64 {
+	if len(keys) == 0 {
+		return 0
+	}
+	moved := 0
+	for _, key := range keys {
+		if before.Get(key) != after.Get(key) {
+			moved++
+		}
+	}
+	return float64(moved) / float64(len(keys))
+}
+
+// SyntheticKeys 生成 n 个形如 prefix0、prefix1 …… 的连续键，
+// 连续键是对哈希函数分布最不利的情形之一。
+func SyntheticKeys(prefix string, n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = prefix + strconv.Itoa(i)
+	}
+	return keys
+}
+
+// Sorted 返回按 KeySpace 从大到小排序的节点统计，便于找出负载最重的节点
+func (r Report) Sorted() []NodeStat {
+	nodes := append([]NodeStat(nil), r.Nodes...)
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].KeySpace > nodes[j].KeySpace
+	})
+	return nodes
+}
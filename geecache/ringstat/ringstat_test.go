@@ -0,0 +1,48 @@
+package ringstat
+
+import (
+	"geecache/consistenthash"
+	"math"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	m := consistenthash.New(100, nil)
+	m.Add("a", "b", "c")
+	m.AddWeighted("d", 3)
+
+	r := Analyze(m, SyntheticKeys("key", 10000))
+	if len(r.Nodes) != 4 {
+		t.Fatalf("report has %d nodes, want 4", len(r.Nodes))
+	}
+	space, keys := 0.0, 0
+	for _, s := range r.Nodes {
+		space += s.KeySpace
+		keys += s.Keys
+	}
+	if math.Abs(space-1) > 1e-9 || keys != 10000 {
+		t.Fatalf("key space sums to %v, keys sum to %d", space, keys)
+	}
+	if r.Sorted()[0].Node != "d" {
+		t.Errorf("weight 3 node should own the largest share, got %v", r.Sorted())
+	}
+	if r.KeySpaceStdDev <= 0 || r.KeySpaceStdDev > 0.5 {
+		t.Errorf("KeySpaceStdDev = %v", r.KeySpaceStdDev)
+	}
+}
+
+func TestMoved(t *testing.T) {
+	before := consistenthash.New(100, nil)
+	before.Add("a", "b", "c", "d")
+	after := consistenthash.New(100, nil)
+	after.Add("a", "b", "c", "d", "e")
+
+	keys := SyntheticKeys("key", 10000)
+	// 新增第 5 个节点时，期望约有 1/5 的键迁移
+	if moved := Moved(before, after, keys); moved < 0.1 || moved > 0.3 {
+		t.Errorf("Moved = %v, want about 0.2", moved)
+	}
+	if moved := Moved(before, before, keys); moved != 0 {
+		t.Errorf("Moved between identical rings = %v", moved)
+	}
+}
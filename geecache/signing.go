@@ -0,0 +1,122 @@
+package geecache
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	timestampHeader = "X-Geecache-Timestamp" // Unix time of signing, in seconds
+	nonceHeader     = "X-Geecache-Nonce"     // random, used once per request
+	signatureHeader = "X-Geecache-Signature" // hex HMAC-SHA256
+	// maxSignatureAge is how far the timestamp of a signed request may be
+	// from the receiver's clock. Nonces are remembered for as long.
+	maxSignatureAge = 30 * time.Second
+)
+
+// signer signs requests to peers and verifies requests from peers with
+// shared secrets. The signature covers the method, the path, the timestamp
+// and a nonce, so a request cannot be changed to load another key, and
+// cannot be replayed: an old timestamp is rejected, and a recent one is
+// accepted only once per nonce.
+type signer struct {
+	// secrets[0] signs, all of them verify, so that a new secret can be
+	// rolled out to every peer before any peer signs with it.
+	secrets [][]byte
+	mu      sync.Mutex
+	nonces  map[string]time.Time // nonces seen, until their requests expire
+	sweepAt int                  // sweep expired nonces at this many entries
+}
+
+// newSigner returns a signer for secrets, or nil if there are none.
+func newSigner(secrets [][]byte) *signer {
+	if len(secrets) == 0 {
+		return nil
+	}
+	return &signer{secrets: secrets, nonces: make(map[string]time.Time)}
+}
+
+// signature computes the signature of a request with secret.
+func signature(secret []byte, method, path, timestamp, nonce string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	io.WriteString(mac, method+"\n"+path+"\n"+timestamp+"\n"+nonce)
+	return mac.Sum(nil)
+}
+
+// sign adds the signature headers to req.
+func (s *signer) sign(req *http.Request) error {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	nonce := hex.EncodeToString(b)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	sig := signature(s.secrets[0], req.Method, req.URL.EscapedPath(), timestamp, nonce)
+	req.Header.Set(timestampHeader, timestamp)
+	req.Header.Set(nonceHeader, nonce)
+	req.Header.Set(signatureHeader, hex.EncodeToString(sig))
+	return nil
+}
+
+// verify checks the signature of r and that it is not a replay.
+func (s *signer) verify(r *http.Request) error {
+	timestamp := r.Header.Get(timestampHeader)
+	nonce := r.Header.Get(nonceHeader)
+	sig, err := hex.DecodeString(r.Header.Get(signatureHeader))
+	if timestamp == "" || nonce == "" || err != nil || len(sig) == 0 {
+		return errors.New("unsigned request")
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("bad timestamp")
+	}
+	now := time.Now()
+	signed := time.Unix(unix, 0)
+	if signed.Before(now.Add(-maxSignatureAge)) || signed.After(now.Add(maxSignatureAge)) {
+		return errors.New("request expired")
+	}
+
+	valid := false
+	for _, secret := range s.secrets {
+		if hmac.Equal(sig, signature(secret, r.Method, r.URL.EscapedPath(), timestamp, nonce)) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return errors.New("bad signature")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.nonces[nonce]; ok {
+		return errors.New("replayed request")
+	}
+	if len(s.nonces) >= s.sweepAt {
+		s.sweepLocked(now)
+	}
+	// the timestamp check rejects the request after this anyway
+	s.nonces[nonce] = signed.Add(maxSignatureAge)
+	return nil
+}
+
+// sweepLocked forgets the nonces of expired requests.
+func (s *signer) sweepLocked(now time.Time) {
+	for nonce, expires := range s.nonces {
+		if now.After(expires) {
+			delete(s.nonces, nonce)
+		}
+	}
+	s.sweepAt = 2 * len(s.nonces)
+	if s.sweepAt < 1024 {
+		s.sweepAt = 1024
+	}
+}
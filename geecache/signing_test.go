@@ -0,0 +1,75 @@
+package geecache
+
+import (
+	"encoding/hex"
+	pb "geecache/geecachepb"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSignedRequests(t *testing.T) {
+	NewGroup("signed", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value of " + key), nil
+	}))
+	oldSecret, newSecret := []byte("old secret"), []byte("new secret")
+	// 轮换中的服务端同时接受新旧两个密钥
+	server := NewHTTPPoolOpts("server", HTTPPoolOptions{Secrets: [][]byte{newSecret, oldSecret}})
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	get := func(secrets ...[]byte) error {
+		client := NewHTTPPoolOpts("client", HTTPPoolOptions{Secrets: secrets})
+		peer := &httpGetter{pool: client, baseURL: srv.URL + defaultBasePath}
+		return peer.Get(&pb.Request{Group: "signed", Key: "Tom"}, &pb.Response{})
+	}
+	if err := get(newSecret); err != nil {
+		t.Fatalf("Get signed with the new secret: %v", err)
+	}
+	if err := get(oldSecret, newSecret); err != nil {
+		t.Fatalf("Get signed with the old secret: %v", err)
+	}
+	if err := get([]byte("wrong secret")); err == nil {
+		t.Fatalf("Get signed with an unknown secret succeeded")
+	}
+	if err := get(); err == nil {
+		t.Fatalf("unsigned Get succeeded")
+	}
+}
+
+func TestSignerReplay(t *testing.T) {
+	s := newSigner([][]byte{[]byte("secret")})
+	req := httptest.NewRequest(http.MethodGet, defaultBasePath+"signed/Tom", nil)
+	if err := s.sign(req); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.verify(req); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if err := s.verify(req); err == nil {
+		t.Fatalf("replayed request accepted")
+	}
+
+	// 签名不能被用于另一个 key
+	other := httptest.NewRequest(http.MethodGet, defaultBasePath+"signed/Jack", nil)
+	if err := s.sign(other); err != nil {
+		t.Fatal(err)
+	}
+	other.URL.Path = defaultBasePath + "signed/Sam"
+	if err := s.verify(other); err == nil {
+		t.Fatalf("request with a changed path accepted")
+	}
+
+	// 过期的时间戳即使签名正确也被拒绝
+	stale := httptest.NewRequest(http.MethodGet, defaultBasePath+"signed/Tom", nil)
+	timestamp := strconv.FormatInt(time.Now().Add(-2*maxSignatureAge).Unix(), 10)
+	sig := signature([]byte("secret"), stale.Method, stale.URL.EscapedPath(), timestamp, "nonce")
+	stale.Header.Set(timestampHeader, timestamp)
+	stale.Header.Set(nonceHeader, "nonce")
+	stale.Header.Set(signatureHeader, hex.EncodeToString(sig))
+	if err := s.verify(stale); err == nil {
+		t.Fatalf("request with a stale timestamp accepted")
+	}
+}
@@ -1,44 +1,232 @@
 package singleflight
 
-import "sync"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// ErrGoexit 是执行函数的 goroutine 调用了 runtime.Goexit 时，等待者收到的错误
+var ErrGoexit = errors.New("singleflight: runtime.Goexit was called")
+
+// PanicError 是执行函数发生 panic 时，等待者收到的错误。
+// 执行函数的调用者（Do 的第一个调用者）会以它重新 panic。
+type PanicError struct {
+	Value interface{} // recover() 得到的值
+	Stack []byte      // 发生 panic 时的调用栈
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("singleflight: panic: %v\n\n%s", p.Value, p.Stack)
+}
 
 // call 表示正在进行中或已完成的 Do 调用
-type call struct {
-	wg  sync.WaitGroup
-	val interface{}
-	err error
+type call[V any] struct {
+	done chan struct{} // 调用完成后关闭
+	val  V
+	err  error
+
+	dups  int                // 等待同一结果的重复调用数
+	chans []chan<- Result[V] // DoChan 调用者等待结果的通道
+
+	// 以下字段只用于 DoContext 发起的调用
+	refs   int                // 仍在等待结果的调用者数，降为 0 时取消调用
+	cancel context.CancelFunc // 取消传给函数的 context
+}
+
+func newCall[V any]() *call[V] {
+	return &call[V]{done: make(chan struct{})}
+}
+
+// join 登记一个等待 c 的重复调用者。
+// Do 与 DoChan 的调用者无法中途离开，会一直持有引用，因此调用不会被取消。
+func (c *call[V]) join() {
+	c.dups++
+	c.refs++
 }
 
 // Group 表示一类工作，并形成一个命名空间，在此空间内，
 // 可以执行带有重复抑制机制的工作单元。
-type Group struct {
-	mu sync.Mutex       // 锁
-	m  map[string]*call // 初始化
+// K 为键的类型，V 为结果的类型，调用者拿到的结果无需再做类型断言。
+// Group 的零值即可使用。
+type Group[K comparable, V any] struct {
+	mu sync.Mutex     // 锁
+	m  map[K]*call[V] // 延迟初始化
 }
 
+// Result 保存 Do 的结果，用于通过 DoChan 返回的通道传递
+type Result[V any] struct {
+	Val    V
+	Err    error
+	Shared bool // 结果是否同时交给了多个调用者
+}
+
+// UntypedGroup 是以 string 为键、interface{} 为结果的 Group，
+// 与引入类型参数之前的 API 保持一致。
+type UntypedGroup = Group[string, interface{}]
+
+// UntypedResult 是 UntypedGroup.DoChan 传递的结果
+type UntypedResult = Result[interface{}]
+
 // Do 执行给定的函数并返回其结果，确保在给定键下同时只有一个执行实例在进行中。
 // 如果有重复调用进入，重复调用者会等待原始调用完成，并接收相同的执行结果。
-func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+// shared 表示结果是否同时交给了多个调用者。
+// 如果函数 panic，执行它的调用者会重新 panic，重复调用者收到 *PanicError。
+func (g *Group[K, V]) Do(key K, fn func() (V, error)) (v V, err error, shared bool) {
 	g.mu.Lock()
 	if g.m == nil {
-		g.m = make(map[string]*call)
+		g.m = make(map[K]*call[V])
 	}
 	if c, ok := g.m[key]; ok {
+		c.join()
 		g.mu.Unlock()
-		c.wg.Wait()
-		return c.val, c.err
+		<-c.done
+		return c.val, c.err, true
 	}
-	c := new(call)
-	c.wg.Add(1)
+	c := newCall[V]()
 	g.m[key] = c
 	g.mu.Unlock()
 
-	c.val, c.err = fn()
-	c.wg.Done()
+	g.doCall(c, key, fn)
+	if e, ok := c.err.(*PanicError); ok {
+		panic(e)
+	}
+	return c.val, c.err, c.dups > 0
+}
 
+// DoChan 与 Do 相同，但不阻塞，而是返回一个在结果就绪时接收 Result 的通道。
+// 调用者可以配合 select 实现超时，通道不会被关闭。
+// 函数在新的 goroutine 中执行，如果它 panic，所有调用者都收到 *PanicError。
+func (g *Group[K, V]) DoChan(key K, fn func() (V, error)) <-chan Result[V] {
+	ch := make(chan Result[V], 1)
 	g.mu.Lock()
-	delete(g.m, key)
+	if g.m == nil {
+		g.m = make(map[K]*call[V])
+	}
+	if c, ok := g.m[key]; ok {
+		c.join()
+		c.chans = append(c.chans, ch)
+		g.mu.Unlock()
+		return ch
+	}
+	c := newCall[V]()
+	c.chans = append(c.chans, ch)
+	g.m[key] = c
 	g.mu.Unlock()
 
-	return c.val, c.err
+	go g.doCall(c, key, fn)
+	return ch
+}
+
+// doCall 执行 fn，并将结果交给所有等待者。
+// 无论 fn 正常返回、panic 还是调用 runtime.Goexit，都会唤醒等待者并删除 key，
+// 否则之后对该 key 的调用都会永远阻塞。
+func (g *Group[K, V]) doCall(c *call[V], key K, fn func() (V, error)) {
+	normalReturn := false
+	recovered := false
+
+	// 用两层 defer 区分 panic 与 runtime.Goexit：
+	// panic 会被内层的 recover 捕获，而 Goexit 无法被 recover。
+	defer func() {
+		if !normalReturn && !recovered {
+			c.err = ErrGoexit
+		}
+
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		close(c.done)
+		if c.cancel != nil {
+			c.cancel()
+		}
+		// 调用期间 key 可能已被 Forget，此时 g.m[key] 属于新的调用，不能删除
+		if g.m[key] == c {
+			delete(g.m, key)
+		}
+		for _, ch := range c.chans {
+			ch <- Result[V]{c.val, c.err, c.dups > 0}
+		}
+	}()
+
+	func() {
+		defer func() {
+			if !normalReturn {
+				if r := recover(); r != nil {
+					c.err = &PanicError{Value: r, Stack: debug.Stack()}
+				}
+			}
+		}()
+		c.val, c.err = fn()
+		normalReturn = true
+	}()
+
+	if !normalReturn {
+		recovered = true
+	}
+}
+
+// DoContext 与 Do 相同，但每个调用者都可以在自己的 ctx 结束时提前离开，并返回 ctx.Err()。
+// 函数在新的 goroutine 中执行，收到的 context 保留第一个调用者 ctx 中的值，
+// 但只有在所有关心结果的调用者都离开后才会被取消，
+// 因此一个调用者断开连接不会影响其他仍在等待的调用者。
+// 如果函数 panic，所有调用者都收到 *PanicError。
+func (g *Group[K, V]) DoContext(ctx context.Context, key K, fn func(ctx context.Context) (V, error)) (v V, err error, shared bool) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[K]*call[V])
+	}
+	c, ok := g.m[key]
+	if ok {
+		c.dups++
+		c.refs++
+		g.mu.Unlock()
+	} else {
+		c = newCall[V]()
+		c.refs = 1
+		var callCtx context.Context
+		callCtx, c.cancel = context.WithCancel(context.WithoutCancel(ctx))
+		g.m[key] = c
+		g.mu.Unlock()
+
+		go g.doCall(c, key, func() (V, error) {
+			return fn(callCtx)
+		})
+	}
+
+	select {
+	case <-c.done:
+		g.mu.Lock()
+		shared = c.dups > 0
+		g.mu.Unlock()
+		return c.val, c.err, shared
+	case <-ctx.Done():
+		g.leave(c, key)
+		var zero V
+		return zero, ctx.Err(), false
+	}
+}
+
+// leave 注销一个提前离开的调用者，最后一个调用者离开时取消调用。
+// 被取消的调用会从 Group 中删除，之后的调用者会重新执行函数，而不是等待一个已取消的调用。
+func (g *Group[K, V]) leave(c *call[V], key K) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c.refs--
+	if c.refs > 0 || c.cancel == nil {
+		return
+	}
+	c.cancel()
+	if g.m[key] == c {
+		delete(g.m, key)
+	}
+}
+
+// Forget 让 Group 忘记 key 对应的进行中的调用，
+// 之后对该 key 的 Do 会重新执行函数，而不是等待之前的调用。
+// 用于数据失效后强制重新加载。
+func (g *Group[K, V]) Forget(key K) {
+	g.mu.Lock()
+	delete(g.m, key)
+	g.mu.Unlock()
 }
@@ -1,12 +1,18 @@
 package singleflight
 
 import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestDo(t *testing.T) {
-	var g Group
-	v, err := g.Do("key", func() (interface{}, error) {
+	var g UntypedGroup
+	v, err, _ := g.Do("key", func() (interface{}, error) {
 		return "bar", nil
 	})
 
@@ -14,3 +20,344 @@ func TestDo(t *testing.T) {
 		t.Errorf("Do v = %v, error = %v", v, err)
 	}
 }
+
+func TestDoErr(t *testing.T) {
+	var g UntypedGroup
+	someErr := errors.New("some error")
+	v, err, _ := g.Do("key", func() (interface{}, error) {
+		return nil, someErr
+	})
+	if err != someErr || v != nil {
+		t.Errorf("Do v = %v, error = %v", v, err)
+	}
+}
+
+func TestDoDupSuppress(t *testing.T) {
+	var g UntypedGroup
+	var calls int32
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "bar", nil
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	var shared int32
+	started := make(chan struct{})
+	go func() {
+		g.Do("key", fn)
+		close(started)
+	}()
+	waitDups(&g, "key", 0)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err, s := g.Do("key", fn)
+			if v != "bar" || err != nil {
+				t.Errorf("Do v = %v, error = %v", v, err)
+			}
+			if s {
+				atomic.AddInt32(&shared, 1)
+			}
+		}()
+	}
+	// 等待所有重复调用进入等待
+	waitDups(&g, "key", n)
+	close(release)
+	wg.Wait()
+	<-started
+	if calls != 1 || shared != n {
+		t.Errorf("fn called %d times, %d callers shared the result", calls, shared)
+	}
+}
+
+func TestDoChan(t *testing.T) {
+	var g UntypedGroup
+	ch := g.DoChan("key", func() (interface{}, error) {
+		return "bar", nil
+	})
+	select {
+	case res := <-ch:
+		if res.Val != "bar" || res.Err != nil || res.Shared {
+			t.Errorf("DoChan result = %+v", res)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("DoChan timed out")
+	}
+}
+
+func TestForget(t *testing.T) {
+	var g UntypedGroup
+	release := make(chan struct{})
+	first := g.DoChan("key", func() (interface{}, error) {
+		<-release
+		return 1, nil
+	})
+
+	g.Forget("key")
+	v, _, shared := g.Do("key", func() (interface{}, error) {
+		return 2, nil
+	})
+	if v != 2 || shared {
+		t.Errorf("Do after Forget = %v, shared %v, want a fresh call", v, shared)
+	}
+
+	close(release)
+	if res := <-first; res.Val != 1 {
+		t.Errorf("forgotten call yielded %v", res.Val)
+	}
+}
+
+// waitDups 等待 key 对应的调用登记到 Group 中，且有至少 n 个重复调用者
+func waitDups(g *UntypedGroup, key string, n int) {
+	for {
+		g.mu.Lock()
+		c, ok := g.m[key]
+		done := ok && c.dups >= n
+		g.mu.Unlock()
+		if done {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPanicDo(t *testing.T) {
+	var g UntypedGroup
+	release := make(chan struct{})
+	leaderPanic := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			leaderPanic <- recover()
+		}()
+		g.Do("key", func() (interface{}, error) {
+			<-release
+			panic("invalid memory address or nil pointer dereference")
+		})
+	}()
+	waitDups(&g, "key", 0)
+
+	waiterErr := make(chan error, 1)
+	go func() {
+		_, err, _ := g.Do("key", func() (interface{}, error) {
+			return "unreachable", nil
+		})
+		waiterErr <- err
+	}()
+	waitDups(&g, "key", 1)
+	close(release)
+
+	if p, ok := (<-leaderPanic).(*PanicError); !ok || p.Value != "invalid memory address or nil pointer dereference" {
+		t.Errorf("leader should re-panic with *PanicError, got %v", p)
+	}
+	if err := <-waiterErr; err == nil {
+		t.Errorf("waiter should get an error")
+	} else if _, ok := err.(*PanicError); !ok {
+		t.Errorf("waiter got %T, want *PanicError", err)
+	}
+
+	// key 已被清理，之后的调用会重新执行
+	v, err, _ := g.Do("key", func() (interface{}, error) {
+		return "bar", nil
+	})
+	if v != "bar" || err != nil {
+		t.Errorf("Do after panic v = %v, error = %v", v, err)
+	}
+}
+
+func TestPanicDoChan(t *testing.T) {
+	var g UntypedGroup
+	res := <-g.DoChan("key", func() (interface{}, error) {
+		panic("boom")
+	})
+	if p, ok := res.Err.(*PanicError); !ok || p.Value != "boom" {
+		t.Errorf("DoChan result error = %v", res.Err)
+	}
+	if len(g.m) != 0 {
+		t.Errorf("key not cleaned up after panic")
+	}
+}
+
+func TestGoexitDo(t *testing.T) {
+	var g UntypedGroup
+	release := make(chan struct{})
+	leaderDone := make(chan bool, 1)
+	go func() {
+		returned := false
+		defer func() {
+			leaderDone <- returned
+		}()
+		g.Do("key", func() (interface{}, error) {
+			<-release
+			runtime.Goexit()
+			return nil, nil
+		})
+		returned = true
+	}()
+	waitDups(&g, "key", 0)
+
+	waiterErr := make(chan error, 1)
+	go func() {
+		_, err, _ := g.Do("key", func() (interface{}, error) {
+			return "unreachable", nil
+		})
+		waiterErr <- err
+	}()
+	waitDups(&g, "key", 1)
+	close(release)
+
+	if returned := <-leaderDone; returned {
+		t.Errorf("Do should not return when fn calls runtime.Goexit")
+	}
+	if err := <-waiterErr; err != ErrGoexit {
+		t.Errorf("waiter got %v, want ErrGoexit", err)
+	}
+	if _, _, ok := g.Do("key", func() (interface{}, error) { return nil, nil }); ok {
+		t.Errorf("Do after Goexit should run a fresh call")
+	}
+}
+
+func TestGoexitDoChan(t *testing.T) {
+	var g UntypedGroup
+	res := <-g.DoChan("key", func() (interface{}, error) {
+		runtime.Goexit()
+		return nil, nil
+	})
+	if res.Err != ErrGoexit {
+		t.Errorf("DoChan result error = %v, want ErrGoexit", res.Err)
+	}
+}
+
+func TestDoContextWaiterLeaves(t *testing.T) {
+	var g UntypedGroup
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		select {
+		case <-release:
+			return "bar", nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	leader := make(chan UntypedResult, 1)
+	go func() {
+		v, err, shared := g.DoContext(context.Background(), "key", fn)
+		leader <- UntypedResult{v, err, shared}
+	}()
+	waitDups(&g, "key", 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	waiter := make(chan error, 1)
+	go func() {
+		_, err, _ := g.DoContext(ctx, "key", fn)
+		waiter <- err
+	}()
+	waitDups(&g, "key", 1)
+	cancel()
+	if err := <-waiter; err != context.Canceled {
+		t.Fatalf("waiter got %v, want context.Canceled", err)
+	}
+
+	// 第一个调用者仍在等待，调用不会被取消
+	close(release)
+	if res := <-leader; res.Val != "bar" || res.Err != nil || !res.Shared {
+		t.Fatalf("leader got %+v", res)
+	}
+}
+
+func TestDoContextAllLeave(t *testing.T) {
+	var g UntypedGroup
+	cancelled := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	}
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	go func() {
+		_, err, _ := g.DoContext(ctx1, "key", fn)
+		errs <- err
+	}()
+	waitDups(&g, "key", 0)
+	go func() {
+		_, err, _ := g.DoContext(ctx2, "key", fn)
+		errs <- err
+	}()
+	waitDups(&g, "key", 1)
+
+	cancel1()
+	<-errs
+	select {
+	case <-cancelled:
+		t.Fatalf("call cancelled while a caller is still waiting")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	cancel2()
+	<-errs
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatalf("call not cancelled after every caller left")
+	}
+
+	// 已取消的调用被删除，新的调用者会重新执行函数
+	v, err, _ := g.DoContext(context.Background(), "key", func(ctx context.Context) (interface{}, error) {
+		return "fresh", nil
+	})
+	if v != "fresh" || err != nil {
+		t.Fatalf("DoContext after cancellation v = %v, error = %v", v, err)
+	}
+}
+
+func TestDoTyped(t *testing.T) {
+	type key struct{ group, name string }
+	var g Group[key, int]
+	var calls int32
+	release := make(chan struct{})
+	fn := func() (int, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return 42, nil
+	}
+
+	k := key{"scores", "Tom"}
+	ch := g.DoChan(k, fn)
+	v, err, shared := 0, error(nil), false
+	done := make(chan struct{})
+	go func() {
+		v, err, shared = g.Do(k, fn)
+		close(done)
+	}()
+	for {
+		g.mu.Lock()
+		dups := 0
+		if c, ok := g.m[k]; ok {
+			dups = c.dups
+		}
+		g.mu.Unlock()
+		if dups == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	<-done
+
+	if res := <-ch; res.Val != 42 || res.Err != nil || !res.Shared {
+		t.Errorf("DoChan result = %+v", res)
+	}
+	if v != 42 || err != nil || !shared {
+		t.Errorf("Do v = %v, error = %v, shared = %v", v, err, shared)
+	}
+	if calls != 1 {
+		t.Errorf("fn called %d times, want 1", calls)
+	}
+}
@@ -0,0 +1,82 @@
+package geecache
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// MutualTLSConfig returns a TLS config for mutual TLS between peers.
+// The peer presents cert both as a server and as a client, and only
+// accepts peers whose certificates are signed by a CA in caPEM.
+// Use it as HTTPPoolOptions.TLSConfig.
+func MutualTLSConfig(cert tls.Certificate, caPEM []byte) (*tls.Config, error) {
+	cas := x509.NewCertPool()
+	if !cas.AppendCertsFromPEM(caPEM) {
+		return nil, errors.New("geecache: no CA certificate found")
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      cas,
+		ClientCAs:    cas,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// LoadMutualTLSConfig is like MutualTLSConfig but reads the PEM encoded
+// certificate, its key and the CA bundle from files.
+func LoadMutualTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	caPEM, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	return MutualTLSConfig(cert, caPEM)
+}
+
+// newTransport returns the transport of a pool: transport if set,
+// otherwise a copy of http.DefaultTransport using tlsConfig for
+// https:// peers.
+func newTransport(transport http.RoundTripper, tlsConfig *tls.Config) http.RoundTripper {
+	if transport != nil || tlsConfig == nil {
+		return transport
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = tlsConfig.Clone()
+	return t
+}
+
+// ListenAndServe serves the pool on the host and port of its own URL,
+// e.g. "https://10.0.0.2:8008", using the pool's TLS config for https://.
+func (p *HTTPPool) ListenAndServe() error {
+	addr := p.self
+	tlsOn := strings.HasPrefix(addr, "https://")
+	addr = strings.TrimPrefix(strings.TrimPrefix(addr, "https://"), "http://")
+	if i := strings.Index(addr, "/"); i >= 0 {
+		addr = addr[:i]
+	}
+	srv := &http.Server{Addr: addr, Handler: p.handler()}
+	if !tlsOn {
+		return srv.ListenAndServe()
+	}
+	if p.tlsConfig == nil {
+		return errors.New("geecache: https peer without a TLS config")
+	}
+	srv.TLSConfig = p.tlsConfig.Clone()
+	return srv.ListenAndServeTLS("", "")
+}
+
+// handler serves the pool under its base path, and 404 elsewhere,
+// since ServeHTTP panics on requests outside the base path.
+func (p *HTTPPool) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(p.basePath, p)
+	return mux
+}
@@ -0,0 +1,160 @@
+package geecache
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	pb "geecache/geecachepb"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testCA 是测试用的证书颁发机构
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "geecache test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue 签发一个同时可用于服务端和客户端的 127.0.0.1 证书
+func (ca *testCA) issue(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "peer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestMutualTLS(t *testing.T) {
+	NewGroup("mtls", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value of " + key), nil
+	}))
+	ca := newTestCA(t)
+	serverConfig, err := MutualTLSConfig(ca.issue(t), ca.pem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewHTTPPoolOpts("server", HTTPPoolOptions{TLSConfig: serverConfig})
+	srv := httptest.NewUnstartedServer(server)
+	srv.TLS = serverConfig.Clone()
+	srv.StartTLS()
+	defer srv.Close()
+
+	get := func(config *tls.Config) error {
+		client := NewHTTPPoolOpts("client", HTTPPoolOptions{TLSConfig: config, Timeout: time.Second})
+		client.Set(srv.URL)
+		peer, ok := client.Peer(srv.URL)
+		if !ok {
+			t.Fatalf("peer %s not in the pool", srv.URL)
+		}
+		out := &pb.Response{}
+		err := peer.Get(&pb.Request{Group: "mtls", Key: "Tom"}, out)
+		if err == nil && string(out.GetValue()) != "value of Tom" {
+			t.Fatalf("Get = %q", out.GetValue())
+		}
+		return err
+	}
+
+	clientConfig, err := MutualTLSConfig(ca.issue(t), ca.pem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := get(clientConfig); err != nil {
+		t.Fatalf("Get with a certificate of the CA: %v", err)
+	}
+
+	noCert := clientConfig.Clone()
+	noCert.Certificates = nil
+	if err := get(noCert); err == nil {
+		t.Fatalf("Get without a client certificate succeeded")
+	}
+
+	other := newTestCA(t)
+	otherConfig, _ := MutualTLSConfig(other.issue(t), ca.pem)
+	if err := get(otherConfig); err == nil {
+		t.Fatalf("Get with a certificate of another CA succeeded")
+	}
+
+	untrusted, _ := MutualTLSConfig(ca.issue(t), other.pem)
+	if err := get(untrusted); err == nil {
+		t.Fatalf("Get from a server of an untrusted CA succeeded")
+	}
+}
+
+func TestMutualTLSConfigNoCA(t *testing.T) {
+	if _, err := MutualTLSConfig(tls.Certificate{}, []byte("not a certificate")); err == nil {
+		t.Fatalf("MutualTLSConfig accepted a bundle without certificates")
+	}
+}
+
+func TestListenAndServeHandler(t *testing.T) {
+	NewGroup("handler", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value of " + key), nil
+	}))
+	pool := NewHTTPPool("self")
+	srv := httptest.NewServer(pool.handler())
+	defer srv.Close()
+
+	// 基础路径之外的请求返回 404，而不是 panic
+	for _, path := range []string{"/", "/favicon.ico"} {
+		res, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusNotFound {
+			t.Fatalf("GET %s returned %v, want 404", path, res.Status)
+		}
+	}
+	res, err := http.Get(srv.URL + defaultBasePath + "handler/Tom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("GET of a key returned %v", res.Status)
+	}
+}
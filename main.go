@@ -5,15 +5,17 @@ $ curl "http://localhost:8080/api?key=Tom"
 630
 
 $ curl "http://localhost:8080/api?key=kkk"
-kkk not exist
+kkk not exist: not found
 */
 
 import (
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"geecache"
 	"log"
 	"net/http"
+	"strings"
 )
 
 var db = map[string]string{
@@ -29,23 +31,23 @@ func createGroup() *geecache.Group {
 			if v, ok := db[key]; ok {
 				return []byte(v), nil
 			}
-			return nil, fmt.Errorf("%s not exist", key)
+			return nil, fmt.Errorf("%s not exist: %w", key, geecache.ErrNotFound)
 		}))
 }
 
-func startCacheServer(addr string, addrs []string, gee *geecache.Group) {
-	peers := geecache.NewHTTPPool(addr)
+func startCacheServer(addr string, addrs []string, gee *geecache.Group, tlsConfig *tls.Config, secrets [][]byte) {
+	peers := geecache.NewHTTPPoolOpts(addr, geecache.HTTPPoolOptions{TLSConfig: tlsConfig, Secrets: secrets})
 	peers.Set(addrs...)
 	gee.RegisterPeers(peers)
 	log.Println("geecache is running at", addr)
-	log.Fatal(http.ListenAndServe(addr[7:], peers))
+	log.Fatal(peers.ListenAndServe())
 }
 
 func startAPIServer(apiAddr string, gee *geecache.Group) {
 	http.Handle("/api", http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
 			key := r.URL.Query().Get("key")
-			view, err := gee.Get(key)
+			view, err := gee.GetContext(r.Context(), key)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
@@ -62,15 +64,38 @@ func startAPIServer(apiAddr string, gee *geecache.Group) {
 func main() {
 	var port int
 	var api bool
+	var certFile, keyFile, caFile, secretList string
 	flag.IntVar(&port, "port", 8001, "Geecache server port")
 	flag.BoolVar(&api, "api", true, "Start a api server?")
+	flag.StringVar(&certFile, "tls-cert", "", "certificate of this peer, enables mutual TLS between peers")
+	flag.StringVar(&keyFile, "tls-key", "", "key of the certificate of this peer")
+	flag.StringVar(&caFile, "tls-ca", "", "CA bundle that signs the certificates of all peers")
+	flag.StringVar(&secretList, "secrets", "", "comma separated secrets to sign requests between peers, the first one signs")
 	flag.Parse()
 
+	scheme := "http"
+	var tlsConfig *tls.Config
+	if certFile != "" {
+		var err error
+		tlsConfig, err = geecache.LoadMutualTLSConfig(certFile, keyFile, caFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		scheme = "https"
+	}
+
+	var secrets [][]byte
+	if secretList != "" {
+		for _, secret := range strings.Split(secretList, ",") {
+			secrets = append(secrets, []byte(secret))
+		}
+	}
+
 	apiAddr := "http://localhost:8080"
 	addrMap := map[int]string{
-		8001: "http://localhost:8001",
-		8002: "http://localhost:8002",
-		8003: "http://localhost:8003",
+		8001: scheme + "://localhost:8001",
+		8002: scheme + "://localhost:8002",
+		8003: scheme + "://localhost:8003",
 	}
 
 	var addrs []string
@@ -82,5 +107,5 @@ func main() {
 	if api {
 		go startAPIServer(apiAddr, gee)
 	}
-	startCacheServer(addrMap[port], addrs, gee)
+	startCacheServer(addrMap[port], addrs, gee, tlsConfig, secrets)
 }